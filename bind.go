@@ -0,0 +1,403 @@
+package quang
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/netip"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+type struct_field_t struct {
+	name    string
+	index   int
+	dtype   data_type_t
+	pointer bool
+	// nested structs are bound with dotted names, like `geo.country`
+	nested bool
+	// embedded structs without a tag have their fields promoted, so they are bound without a prefix
+	embedded bool
+	// type of the items of slices, which are bound as lists
+	itemType data_type_t
+}
+
+// The fields of each struct type are inspected only once,
+// every other binding of the same type reuses the plan
+var structPlans sync.Map
+
+var atomType = reflect.TypeOf(AtomType(0))
+var timeType = reflect.TypeOf(time.Time{})
+var durationType = reflect.TypeOf(time.Duration(0))
+var ipType = reflect.TypeOf(netip.Addr{})
+
+func kindToDataType(t reflect.Type) (data_type_t, bool) {
+	switch t {
+	case atomType:
+		return dtype_atom, true
+	case timeType:
+		return dtype_time, true
+	case durationType:
+		return dtype_duration, true
+	case ipType:
+		return dtype_ip, true
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return dtype_integer, true
+	case reflect.Float32, reflect.Float64:
+		return dtype_float, true
+	case reflect.String:
+		return dtype_string, true
+	case reflect.Bool:
+		return dtype_bool, true
+	}
+
+	return dtype_nil, false
+}
+
+// Slices of integers, floats, strings and atoms are lists
+func sliceItemType(t reflect.Type) (data_type_t, bool) {
+	if t.Kind() != reflect.Slice {
+		return dtype_nil, false
+	}
+
+	dtype, ok := kindToDataType(t.Elem())
+
+	switch dtype {
+	case dtype_integer, dtype_float, dtype_string, dtype_atom:
+		return dtype, ok
+	}
+
+	return dtype_nil, false
+}
+
+func planStruct(t reflect.Type) []struct_field_t {
+	if plan, ok := structPlans.Load(t); ok {
+		return plan.([]struct_field_t)
+	}
+
+	plan := make([]struct_field_t, 0, t.NumField())
+	promoted := make([]struct_field_t, 0)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		tagged := false
+
+		if tag, ok := field.Tag.Lookup("quang"); ok {
+			if tag == "-" {
+				continue
+			}
+
+			if tag != "" {
+				name = tag
+				tagged = true
+			}
+		}
+
+		fieldType := field.Type
+		pointer := fieldType.Kind() == reflect.Pointer
+
+		if pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		dtype, ok := kindToDataType(fieldType)
+		itemType, isList := sliceItemType(fieldType)
+		nested := !ok && fieldType.Kind() == reflect.Struct
+
+		if isList {
+			dtype = dtype_list
+		} else if !ok && !nested {
+			continue
+		}
+
+		planned := struct_field_t{
+			name:     name,
+			index:    i,
+			dtype:    dtype,
+			pointer:  pointer,
+			nested:   nested,
+			embedded: nested && field.Anonymous && !tagged,
+			itemType: itemType,
+		}
+
+		if planned.embedded {
+			promoted = append(promoted, planned)
+		} else {
+			plan = append(plan, planned)
+		}
+	}
+
+	// embedded structs are bound first, so the fields of the outer struct
+	// take precedence over the promoted ones with the same name
+	plan = append(promoted, plan...)
+
+	structPlans.Store(t, plan)
+
+	return plan
+}
+
+func (s symbol_table_t) bindStruct(v any) error {
+	value := reflect.ValueOf(v)
+
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return fmt.Errorf("error: cannot bind a nil pointer")
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("error: cannot bind %s, expected a struct", value.Kind())
+	}
+
+	s.bindFields("", value, []reflect.Type{value.Type()})
+
+	return nil
+}
+
+// `parents` are the struct types being bound, nested fields of the same type
+// are skipped, otherwise self-referencing types would be bound forever.
+// Values that cannot be bound are kept as errors, reported only if the query reads them
+func (s symbol_table_t) bindFields(prefix string, value reflect.Value, parents []reflect.Type) {
+	for _, field := range planStruct(value.Type()) {
+		name := prefix + field.name
+		fieldValue := value.Field(field.index)
+		nestedPrefix := name + "."
+
+		if field.embedded {
+			nestedPrefix = prefix
+		}
+
+		if field.pointer {
+			if fieldValue.IsNil() {
+				if field.nested {
+					s.bindNilFields(nestedPrefix, fieldValue.Type().Elem(), parents)
+				} else {
+					s.addNilVar(name)
+				}
+
+				continue
+			}
+
+			fieldValue = fieldValue.Elem()
+		}
+
+		if field.nested {
+			if slices.Contains(parents, fieldValue.Type()) {
+				continue
+			}
+
+			s.bindFields(nestedPrefix, fieldValue, append(parents, fieldValue.Type()))
+
+			continue
+		}
+
+		switch field.dtype {
+		case dtype_atom:
+			s.addAtomVar(name, AtomType(fieldValue.Int()))
+		case dtype_integer:
+			if fieldValue.CanInt() {
+				s.addIntegerVar(name, IntegerType(fieldValue.Int()))
+			} else {
+				n := fieldValue.Uint()
+
+				if n > math.MaxInt64 {
+					s[name] = variable_t{err: fmt.Errorf("error: the field '%s' overflows integer with value %d", name, n)}
+				} else {
+					s.addIntegerVar(name, IntegerType(n))
+				}
+			}
+		case dtype_float:
+			s.addFloatVar(name, FloatType(fieldValue.Float()))
+		case dtype_string:
+			s.addStringVar(name, fieldValue.String())
+		case dtype_bool:
+			s.addBoolVar(name, fieldValue.Bool())
+		case dtype_time:
+			s.addTimeVar(name, fieldValue.Interface().(time.Time))
+		case dtype_duration:
+			s.addDurationVar(name, time.Duration(fieldValue.Int()))
+		case dtype_ip:
+			s.addIPVar(name, fieldValue.Interface().(netip.Addr))
+		case dtype_list:
+			{
+				variable, err := sliceToVariable(name, fieldValue, field.itemType)
+
+				if err != nil {
+					variable = variable_t{err: err}
+				}
+
+				s[name] = variable
+			}
+		}
+	}
+}
+
+// The fields of a nil nested struct are all nil, just like missing keys of maps
+func (s symbol_table_t) bindNilFields(prefix string, t reflect.Type, parents []reflect.Type) {
+	if slices.Contains(parents, t) {
+		return
+	}
+
+	for _, field := range planStruct(t) {
+		if !field.nested {
+			s.addNilVar(prefix + field.name)
+
+			continue
+		}
+
+		fieldType := t.Field(field.index).Type
+		nestedPrefix := prefix + field.name + "."
+
+		if field.pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.embedded {
+			nestedPrefix = prefix
+		}
+
+		s.bindNilFields(nestedPrefix, fieldType, append(parents, t))
+	}
+}
+
+func sliceToVariable(name string, value reflect.Value, itemType data_type_t) (variable_t, error) {
+	list := make([]variable_t, 0, value.Len())
+
+	for i := 0; i < value.Len(); i++ {
+		item := value.Index(i)
+
+		switch itemType {
+		case dtype_atom:
+			list = append(list, variable_t{dtype: dtype_atom, atom: AtomType(item.Int())})
+		case dtype_integer:
+			if item.CanInt() {
+				list = append(list, variable_t{dtype: dtype_integer, integer: IntegerType(item.Int())})
+			} else {
+				n := item.Uint()
+
+				if n > math.MaxInt64 {
+					return variable_t{}, fmt.Errorf("error: the item %d of '%s' overflows integer with value %d", i, name, n)
+				}
+
+				list = append(list, variable_t{dtype: dtype_integer, integer: IntegerType(n)})
+			}
+		case dtype_float:
+			list = append(list, variable_t{dtype: dtype_float, float: FloatType(item.Float())})
+		case dtype_string:
+			list = append(list, variable_t{dtype: dtype_string, string: item.String()})
+		}
+	}
+
+	return variable_t{dtype: dtype_list, itemType: itemType, list: list}, nil
+}
+
+// Decoded JSON arrays are `[]any`, all the items must be integers, floats, strings or atoms,
+// of the same type. Integers are promoted to float when mixed with floats, like in `[1, 2.5]`
+func anySliceToVariable(name string, values []any) (variable_t, error) {
+	list := make([]variable_t, 0, len(values))
+	itemType := dtype_nil
+
+	for _, value := range values {
+		item, err := valueToVariable(name, value)
+
+		if err != nil {
+			return variable_t{}, err
+		}
+
+		switch item.dtype {
+		case dtype_integer, dtype_float, dtype_string, dtype_atom:
+		default:
+			return variable_t{}, fmt.Errorf("error: the variable '%s' has an item of unsupported type %T", name, value)
+		}
+
+		switch {
+		case itemType == dtype_nil || itemType == item.dtype:
+			itemType = item.dtype
+		case (itemType == dtype_integer || itemType == dtype_float) && (item.dtype == dtype_integer || item.dtype == dtype_float):
+			itemType = dtype_float
+		default:
+			return variable_t{}, fmt.Errorf("error: the variable '%s' has items of different types, %s and %s", name, dtype_to_string[itemType], dtype_to_string[item.dtype])
+		}
+
+		list = append(list, item)
+	}
+
+	if itemType == dtype_float {
+		for i, item := range list {
+			if item.dtype == dtype_integer {
+				list[i] = variable_t{dtype: dtype_float, float: FloatType(item.integer)}
+			}
+		}
+	}
+
+	return variable_t{dtype: dtype_list, itemType: itemType, list: list}, nil
+}
+
+// Converts values of decoded records (for example, JSON decoded into `map[string]any`)
+// into variables. Integer numbers stay integers, everything else numeric becomes a float
+func valueToVariable(name string, value any) (variable_t, error) {
+	switch v := value.(type) {
+	case nil:
+		return variable_t{dtype: dtype_nil}, nil
+	case string:
+		return variable_t{dtype: dtype_string, string: v}, nil
+	case bool:
+		return variable_t{dtype: dtype_bool, bool: v}, nil
+	case AtomType:
+		return variable_t{dtype: dtype_atom, atom: v}, nil
+	case time.Time:
+		return variable_t{dtype: dtype_time, time: v}, nil
+	case time.Duration:
+		return variable_t{dtype: dtype_duration, duration: v}, nil
+	case netip.Addr:
+		return variable_t{dtype: dtype_ip, ip: v.Unmap()}, nil
+	case IntegerType:
+		return variable_t{dtype: dtype_integer, integer: v}, nil
+	case FloatType:
+		return variable_t{dtype: dtype_float, float: v}, nil
+	case int:
+		return variable_t{dtype: dtype_integer, integer: IntegerType(v)}, nil
+	case int64:
+		return variable_t{dtype: dtype_integer, integer: IntegerType(v)}, nil
+	case int32:
+		return variable_t{dtype: dtype_integer, integer: IntegerType(v)}, nil
+	case float64:
+		return variable_t{dtype: dtype_float, float: FloatType(v)}, nil
+	case float32:
+		return variable_t{dtype: dtype_float, float: FloatType(v)}, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return variable_t{dtype: dtype_integer, integer: IntegerType(n)}, nil
+		}
+
+		n, err := v.Float64()
+
+		if err != nil {
+			return variable_t{}, fmt.Errorf("error: the variable '%s' is not a valid number \"%s\"", name, v.String())
+		}
+
+		return variable_t{dtype: dtype_float, float: FloatType(n)}, nil
+	case []any:
+		return anySliceToVariable(name, v)
+	}
+
+	if itemType, ok := sliceItemType(reflect.TypeOf(value)); ok {
+		return sliceToVariable(name, reflect.ValueOf(value), itemType)
+	}
+
+	return variable_t{}, fmt.Errorf("error: the variable '%s' has unsupported type %T", name, value)
+}
@@ -0,0 +1,572 @@
+package quang
+
+import (
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bind_row_t struct {
+	Status  uint16   `quang:"status"`
+	Size    int      `quang:"size"`
+	Latency float32  `quang:"latency"`
+	Agent   string   `quang:"agent"`
+	Alive   bool     `quang:"alive"`
+	Method  AtomType `quang:"method"`
+	Region  *string  `quang:"region"`
+	Ignored string   `quang:"-"`
+	Name    string
+	secret  string
+	Tags    []string
+}
+
+func TestPlanningStructs(t *testing.T) {
+	plan := planStruct(reflect.TypeOf(bind_row_t{}))
+
+	names := make([]string, 0, len(plan))
+
+	for _, field := range plan {
+		names = append(names, field.name)
+	}
+
+	assert.Equal(t, []string{"status", "size", "latency", "agent", "alive", "method", "region", "Name", "Tags"}, names)
+	assert.Equal(t, dtype_integer, plan[0].dtype)
+	assert.Equal(t, dtype_float, plan[2].dtype)
+	assert.Equal(t, dtype_atom, plan[5].dtype)
+	assert.Equal(t, dtype_string, plan[6].dtype)
+	assert.Equal(t, true, plan[6].pointer)
+	assert.Equal(t, dtype_list, plan[8].dtype)
+	assert.Equal(t, dtype_string, plan[8].itemType)
+
+	cached, ok := structPlans.Load(reflect.TypeOf(bind_row_t{}))
+
+	assert.True(t, ok)
+	assert.Equal(t, plan, cached)
+}
+
+func TestBindingStructs(t *testing.T) {
+	e := createEvaluator(nil)
+
+	region := "us"
+
+	err := e.symbols.bindStruct(&bind_row_t{
+		Status:  200,
+		Size:    10,
+		Latency: 1.5,
+		Agent:   "curl",
+		Alive:   true,
+		Method:  2,
+		Region:  &region,
+		Ignored: "ignored",
+		Name:    "john",
+		Tags:    []string{"prod", "api"},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, variable_t{dtype: dtype_integer, integer: 200}, e.symbols["status"])
+	assert.Equal(t, variable_t{dtype: dtype_integer, integer: 10}, e.symbols["size"])
+	assert.Equal(t, variable_t{dtype: dtype_float, float: 1.5}, e.symbols["latency"])
+	assert.Equal(t, variable_t{dtype: dtype_string, string: "curl"}, e.symbols["agent"])
+	assert.Equal(t, variable_t{dtype: dtype_bool, bool: true}, e.symbols["alive"])
+	assert.Equal(t, variable_t{dtype: dtype_atom, atom: 2}, e.symbols["method"])
+	assert.Equal(t, variable_t{dtype: dtype_string, string: "us"}, e.symbols["region"])
+	assert.Equal(t, variable_t{dtype: dtype_string, string: "john"}, e.symbols["Name"])
+	assert.NotContains(t, e.symbols, "Ignored")
+	assert.NotContains(t, e.symbols, "secret")
+	assert.Equal(t, stringListVariable([]string{"prod", "api"}), e.symbols["Tags"])
+
+	err = e.symbols.bindStruct(bind_row_t{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, variable_t{dtype: dtype_nil}, e.symbols["region"])
+
+	err = e.symbols.bindStruct(10)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: cannot bind int, expected a struct", err.Error())
+
+	err = e.symbols.bindStruct((*bind_row_t)(nil))
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: cannot bind a nil pointer", err.Error())
+
+}
+
+func TestBindingOverflowingFields(t *testing.T) {
+	type hashed_row_t struct {
+		Status int      `quang:"status"`
+		Hash   uint64   `quang:"hash"`
+		Sizes  []uint64 `quang:"sizes"`
+		Method string   `quang:"method"`
+	}
+
+	row := hashed_row_t{
+		Status: 200,
+		Hash:   1 << 63,
+		Sizes:  []uint64{1, 1 << 63},
+		Method: "GET",
+	}
+
+	tests := map[string]bool{
+		"status eq 200":                     true,
+		"method eq 'GET' and status ne 500": true,
+		"status eq 500 and hash eq 1":       false,
+	}
+
+	for query, expected := range tests {
+		q, err := Init(query)
+
+		assert.Nil(t, err)
+
+		result, err := q.EvalStruct(row)
+
+		assert.Nil(t, err, "query: %s", query)
+		assert.Equal(t, expected, result, "query: %s", query)
+	}
+
+	fail_tests := map[string]string{
+		"hash eq 1":                          "error: the field 'hash' overflows integer with value 9223372036854775808",
+		"hash eq nil":                        "error: the field 'hash' overflows integer with value 9223372036854775808",
+		"status eq 200 and sizes contains 1": "error: the item 1 of 'sizes' overflows integer with value 9223372036854775808",
+	}
+
+	for query, expected := range fail_tests {
+		q, err := Init(query)
+
+		assert.Nil(t, err)
+
+		result, err := q.EvalStruct(row)
+
+		assert.NotNil(t, err, "query: %s", query)
+		assert.Equal(t, expected, err.Error(), "query: %s", query)
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestConvertingValuesToVariables(t *testing.T) {
+	type test_case_t struct {
+		value    any
+		variable variable_t
+	}
+
+	tests := []test_case_t{
+		{value: nil, variable: variable_t{dtype: dtype_nil}},
+		{value: "get", variable: variable_t{dtype: dtype_string, string: "get"}},
+		{value: true, variable: variable_t{dtype: dtype_bool, bool: true}},
+		{value: 1.5, variable: variable_t{dtype: dtype_float, float: 1.5}},
+		{value: 10, variable: variable_t{dtype: dtype_integer, integer: 10}},
+		{value: json.Number("200"), variable: variable_t{dtype: dtype_integer, integer: 200}},
+		{value: json.Number("2.5"), variable: variable_t{dtype: dtype_float, float: 2.5}},
+		{value: AtomType(3), variable: variable_t{dtype: dtype_atom, atom: 3}},
+	}
+
+	for _, test := range tests {
+		variable, err := valueToVariable("x", test.value)
+
+		assert.Nil(t, err)
+		assert.Equal(t, test.variable, variable, "value: %v", test.value)
+	}
+
+	_, err := valueToVariable("x", []bool{})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: the variable 'x' has unsupported type []bool", err.Error())
+
+	_, err = valueToVariable("x", json.Number("abc"))
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: the variable 'x' is not a valid number \"abc\"", err.Error())
+}
+
+func TestEvaluatingMaps(t *testing.T) {
+	l := createLexer("status gte 500 and latency gt 10 and agent ne nil and not cached")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+
+	expr, err := p.parseExpression()
+
+	assert.Nil(t, err)
+
+	e := createEvaluator(expr)
+
+	var record map[string]any
+
+	err = json.Unmarshal([]byte(`{"status": 503, "latency": 12.5, "agent": "curl", "cached": false}`), &record)
+
+	assert.Nil(t, err)
+
+	result, err := e.evalMap(record)
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	result, err = e.evalMap(map[string]any{"status": 503, "latency": 12.5, "agent": nil, "cached": false})
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, result)
+
+	result, err = e.evalMap(map[string]any{"status": 503, "latency": 12.5, "cached": false})
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, result)
+
+	result, err = e.evalMap(map[string]any{"latency": 12.5})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, false, result)
+	assert.Equal(t, "error: the variable 'status' does not exist", err.Error())
+
+	e.addIntegerVar("status", 503)
+
+	result, err = e.evalMap(nil)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, false, result)
+	assert.Equal(t, "error: the variable 'status' does not exist", err.Error())
+	assert.Nil(t, e.resolver)
+}
+
+type bind_geo_t struct {
+	Country string `quang:"country"`
+	City    *string
+}
+
+type bind_node_t struct {
+	Value int
+	Next  *bind_node_t
+}
+
+type bind_request_t struct {
+	Geo     bind_geo_t  `quang:"geo"`
+	Origin  *bind_geo_t `quang:"origin"`
+	Node    bind_node_t `quang:"node"`
+	Status  int         `quang:"status"`
+	Ignored bind_geo_t  `quang:"-"`
+}
+
+func TestBindingNestedStructs(t *testing.T) {
+	plan := planStruct(reflect.TypeOf(bind_request_t{}))
+
+	assert.Equal(t, 4, len(plan))
+	assert.True(t, plan[0].nested)
+	assert.True(t, plan[1].nested)
+	assert.True(t, plan[1].pointer)
+	assert.False(t, plan[3].nested)
+
+	e := createEvaluator(nil)
+
+	city := "recife"
+
+	err := e.symbols.bindStruct(bind_request_t{
+		Geo:    bind_geo_t{Country: "br", City: &city},
+		Node:   bind_node_t{Value: 1, Next: &bind_node_t{Value: 2}},
+		Status: 200,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, variable_t{dtype: dtype_string, string: "br"}, e.symbols["geo.country"])
+	assert.Equal(t, variable_t{dtype: dtype_string, string: "recife"}, e.symbols["geo.City"])
+	assert.Equal(t, variable_t{dtype: dtype_nil}, e.symbols["origin.country"])
+	assert.Equal(t, variable_t{dtype: dtype_nil}, e.symbols["origin.City"])
+	assert.Equal(t, variable_t{dtype: dtype_integer, integer: 1}, e.symbols["node.Value"])
+	assert.Equal(t, variable_t{dtype: dtype_integer, integer: 200}, e.symbols["status"])
+	assert.NotContains(t, e.symbols, "node.Next.Value")
+	assert.NotContains(t, e.symbols, "geo")
+	assert.NotContains(t, e.symbols, "Ignored.country")
+}
+
+type BindBase struct {
+	ID      int
+	Status  int
+	Created string `quang:"created"`
+}
+
+type BindLocation struct {
+	Country string `quang:"country"`
+	City    *string
+}
+
+type bind_row_embedding_t struct {
+	BindBase
+	*BindLocation
+	Status int
+	Geo    BindBase `quang:"geo"`
+}
+
+type bind_tagged_embedding_t struct {
+	BindBase `quang:"base"`
+	Name     string
+}
+
+func TestBindingEmbeddedStructs(t *testing.T) {
+	plan := planStruct(reflect.TypeOf(bind_row_embedding_t{}))
+
+	assert.Equal(t, 4, len(plan))
+	assert.True(t, plan[0].embedded)
+	assert.True(t, plan[1].embedded)
+	assert.False(t, plan[3].embedded)
+
+	e := createEvaluator(nil)
+
+	err := e.symbols.bindStruct(bind_row_embedding_t{
+		BindBase: BindBase{ID: 1, Status: 500, Created: "today"},
+		Status:   200,
+		Geo:      BindBase{ID: 2},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, variable_t{dtype: dtype_integer, integer: 1}, e.symbols["ID"])
+	assert.Equal(t, variable_t{dtype: dtype_integer, integer: 200}, e.symbols["Status"])
+	assert.Equal(t, variable_t{dtype: dtype_string, string: "today"}, e.symbols["created"])
+	assert.Equal(t, variable_t{dtype: dtype_nil}, e.symbols["country"])
+	assert.Equal(t, variable_t{dtype: dtype_nil}, e.symbols["City"])
+	assert.Equal(t, variable_t{dtype: dtype_integer, integer: 2}, e.symbols["geo.ID"])
+	assert.NotContains(t, e.symbols, "BindBase.ID")
+
+	e = createEvaluator(nil)
+
+	err = e.symbols.bindStruct(bind_tagged_embedding_t{
+		BindBase: BindBase{ID: 3},
+		Name:     "john",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, variable_t{dtype: dtype_integer, integer: 3}, e.symbols["base.ID"])
+	assert.NotContains(t, e.symbols, "ID")
+
+	q, err := Init("ID eq 1 and Status eq 200 and country eq 'br'")
+
+	assert.Nil(t, err)
+
+	result, err := q.EvalStruct(&bind_row_embedding_t{
+		BindBase:     BindBase{ID: 1, Status: 500},
+		BindLocation: &BindLocation{Country: "br"},
+		Status:       200,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+}
+
+func TestEvaluatingNestedMaps(t *testing.T) {
+	tests := map[string]bool{
+		"request.headers.user_agent reg 'curl'":               true,
+		"geo.country eq 'br' and geo.city eq nil":             true,
+		"geo.missing.deep eq nil":                             true,
+		"request.body.size eq nil":                            true,
+		"request.headers.user_agent ne nil and status eq 200": true,
+	}
+
+	record := map[string]any{
+		"request": map[string]any{
+			"headers": map[string]any{"user_agent": "curl/8.0"},
+			"body":    nil,
+		},
+		"geo":    map[string]any{"country": "br"},
+		"status": 200,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		result, err := e.evalMap(record)
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	l := createLexer("region.name eq 'x'")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+
+	expr, err := p.parse()
+
+	assert.Nil(t, err)
+
+	e := createEvaluator(expr)
+
+	_, err = e.evalMap(record)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: the variable 'region.name' does not exist", err.Error())
+
+	l = createLexer("status.code eq nil")
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+
+	expr, err = p.parse()
+
+	assert.Nil(t, err)
+
+	e = createEvaluator(expr)
+
+	_, err = e.evalMap(record)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: the variable 'status' has type int, so it has no field 'code'", err.Error())
+}
+
+func TestBindingTimesAndDurations(t *testing.T) {
+	type request_t struct {
+		Started time.Time     `quang:"started"`
+		Elapsed time.Duration `quang:"elapsed"`
+		Ended   *time.Time    `quang:"ended"`
+	}
+
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	q, err := Init("started gte 2024-05-01T12:00:00Z and elapsed gt 1s and ended eq nil")
+
+	assert.Nil(t, err)
+
+	result, err := q.EvalStruct(request_t{Started: started, Elapsed: 2 * time.Second})
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	result, err = q.EvalMap(map[string]any{"started": started, "elapsed": 2 * time.Second, "ended": nil})
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	result, err = q.EvalMap(map[string]any{"started": started, "elapsed": time.Second, "ended": nil})
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, result)
+}
+
+func TestBindingAddresses(t *testing.T) {
+	type packet_t struct {
+		Source      netip.Addr  `quang:"src_ip"`
+		Destination *netip.Addr `quang:"dst_ip"`
+	}
+
+	q, err := Init("src_ip in 10.0.0.0/8 and dst_ip eq nil")
+
+	assert.Nil(t, err)
+
+	result, err := q.EvalStruct(packet_t{Source: netip.MustParseAddr("10.1.2.3")})
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	result, err = q.EvalMap(map[string]any{"src_ip": netip.MustParseAddr("::ffff:10.1.2.3"), "dst_ip": nil})
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	result, err = q.EvalMap(map[string]any{"src_ip": netip.MustParseAddr("192.168.1.1"), "dst_ip": nil})
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, result)
+}
+
+func TestBindingLists(t *testing.T) {
+	type host_t struct {
+		Tags    []string   `quang:"tags"`
+		Ports   []uint16   `quang:"ports"`
+		Weights []float64  `quang:"weights"`
+		Roles   []AtomType `quang:"roles"`
+		Aliases *[]string  `quang:"aliases"`
+		Flags   []bool     `quang:"flags"`
+		Groups  [][]string `quang:"groups"`
+	}
+
+	q, err := Init("tags contains 'prod' and ports contains 443 and any(weights, _ gt 0.5) and roles contains :admin and aliases eq nil")
+
+	assert.Nil(t, err)
+
+	q.SetupAtom(":admin", 1)
+
+	result, err := q.EvalStruct(host_t{
+		Tags:    []string{"prod", "team-api"},
+		Ports:   []uint16{80, 443},
+		Weights: []float64{0.2, 0.8},
+		Roles:   []AtomType{0, 1},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	plan := planStruct(reflect.TypeOf(host_t{}))
+
+	assert.Equal(t, 5, len(plan))
+
+	var record map[string]any
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"tags": ["prod", "team-api"], "ports": [80, 443], "weights": [1, 0.8], "roles": [], "aliases": null}`), &record))
+
+	q, err = Init("tags contains 'prod' and ports contains 443 and weights contains 1 and len(roles) eq 0 and aliases eq nil")
+
+	assert.Nil(t, err)
+
+	result, err = q.EvalMap(record)
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	result, err = q.EvalMap(map[string]any{
+		"tags":    []string{"dev"},
+		"ports":   []int{443},
+		"weights": []float32{1},
+		"roles":   []AtomType{},
+		"aliases": nil,
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, result)
+
+	type test_case_t struct {
+		value    any
+		variable variable_t
+	}
+
+	tests := []test_case_t{
+		{value: []any{"a", "b"}, variable: stringListVariable([]string{"a", "b"})},
+		{value: []any{1, 2.5}, variable: floatListVariable([]FloatType{1, 2.5})},
+		{value: []any{json.Number("1"), json.Number("2")}, variable: integerListVariable([]IntegerType{1, 2})},
+		{value: []any{}, variable: variable_t{dtype: dtype_list, itemType: dtype_nil, list: []variable_t{}}},
+		{value: []int64{7}, variable: integerListVariable([]IntegerType{7})},
+	}
+
+	for _, test := range tests {
+		variable, err := valueToVariable("x", test.value)
+
+		assert.Nil(t, err)
+		assert.Equal(t, test.variable, variable, "value: %v", test.value)
+	}
+
+	fail_tests := map[string]any{
+		"error: the variable 'x' has items of different types, string and integer": []any{"a", 1},
+		"error: the variable 'x' has an item of unsupported type bool":             []any{true},
+		"error: the variable 'x' has an item of unsupported type <nil>":            []any{"a", nil},
+		"error: the variable 'x' has an item of unsupported type []interface {}":   []any{"a", []any{}},
+	}
+
+	for expected, value := range fail_tests {
+		_, err := valueToVariable("x", value)
+
+		assert.NotNil(t, err, "expected: %s", expected)
+		assert.Equal(t, expected, err.Error())
+	}
+}
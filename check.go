@@ -0,0 +1,447 @@
+package quang
+
+type FieldType int
+
+const (
+	IntegerField  FieldType = FieldType(dtype_integer)
+	FloatField    FieldType = FieldType(dtype_float)
+	StringField   FieldType = FieldType(dtype_string)
+	BoolField     FieldType = FieldType(dtype_bool)
+	AtomField     FieldType = FieldType(dtype_atom)
+	TimeField     FieldType = FieldType(dtype_time)
+	DurationField FieldType = FieldType(dtype_duration)
+	IPField       FieldType = FieldType(dtype_ip)
+)
+
+// Lists are marked by a flag on top of the type of their items
+const listField FieldType = 1 << 8
+
+const (
+	IntegerListField FieldType = IntegerField | listField
+	FloatListField   FieldType = FloatField | listField
+	StringListField  FieldType = StringField | listField
+	AtomListField    FieldType = AtomField | listField
+)
+
+// Declares up front which variables and atoms a query can use.
+// Any field can also be nil at evaluation time.
+type Schema struct {
+	Fields map[string]FieldType
+	Atoms  map[string]AtomType
+}
+
+type checker_t struct {
+	fields map[string]FieldType
+	atoms  map[string]AtomType
+
+	// kind of `_` inside the condition of `any` and `all`
+	item    expression_kind_t
+	hasItem bool
+}
+
+var dtype_to_ek = map[data_type_t]expression_kind_t{
+	dtype_integer:  ek_integer,
+	dtype_float:    ek_float,
+	dtype_string:   ek_string,
+	dtype_bool:     ek_bool,
+	dtype_atom:     ek_atom,
+	dtype_nil:      ek_nil,
+	dtype_time:     ek_time,
+	dtype_duration: ek_duration,
+	dtype_ip:       ek_ip,
+}
+
+func createChecker(schema Schema) (checker_t, error) {
+	checker := checker_t{
+		fields: schema.Fields,
+		atoms:  make(map[string]AtomType, len(schema.Atoms)),
+	}
+
+	for name, value := range schema.Atoms {
+		atom, err := parseAtomName(name)
+
+		if err != nil {
+			return checker, err
+		}
+
+		checker.atoms[atom] = value
+	}
+
+	return checker, nil
+}
+
+// Tells which kind an operand will have at evaluation time
+func (c checker_t) operandKind(expr *expression_t) (expression_kind_t, error) {
+	switch expr.kind {
+	case ek_lazy_symbol:
+		{
+			if c.hasItem && expr.symbolName == "_" {
+				return c.item, nil
+			}
+
+			field, ok := c.fields[expr.symbolName]
+
+			if !ok {
+				return ek_nil, unknownVariableError(expr, "error: the variable '%s' does not exist at position %d", expr.symbolName, expr.start+1)
+			}
+
+			if field&listField != 0 {
+				return ek_list, nil
+			}
+
+			return dtype_to_ek[data_type_t(field)], nil
+		}
+	case ek_lazy_atom:
+		{
+			if _, ok := c.atoms[expr.symbolName]; !ok {
+				return ek_nil, unknownAtomError(expr, "error: the atom '%s' does not exist at position %d", expr.symbolName, expr.start+1)
+			}
+
+			return ek_atom, nil
+		}
+	case ek_binary:
+		{
+			binary := expr.binary
+			left, err := c.operandKind(binary.left)
+
+			if err != nil {
+				return ek_nil, err
+			}
+
+			right, err := c.operandKind(binary.right)
+
+			if err != nil {
+				return ek_nil, err
+			}
+
+			kind, ok := arithmeticKind(left, binary.operator, right)
+
+			if !ok {
+				return ek_nil, typeError(expr, "error: you cannot do such operation '%s %s %s' at position %d", ek_to_string[left], bo_to_string[binary.operator], ek_to_string[right], expr.start+1)
+			}
+
+			return kind, nil
+		}
+	case ek_call:
+		{
+			function := expr.call.function
+
+			if function.predicate {
+				return c.checkQuantifier(expr)
+			}
+
+			kinds := make([]expression_kind_t, 0, len(expr.call.args))
+
+			for _, arg := range expr.call.args {
+				kind, err := c.operandKind(arg)
+
+				if err != nil {
+					return ek_nil, err
+				}
+
+				kinds = append(kinds, kind)
+			}
+
+			kind, ok := function.kind(kinds)
+
+			if !ok {
+				return ek_nil, typeError(expr, "error: you cannot call %s at position %d", callSignature(function, kinds), expr.start+1)
+			}
+
+			return kind, nil
+		}
+	case ek_unary:
+		{
+			kind, err := c.operandKind(expr.unary.operand)
+
+			if err != nil {
+				return ek_nil, err
+			}
+
+			if !isNumberKind(kind) && kind != ek_duration {
+				return ek_nil, typeError(expr, "error: you cannot do such operation '-%s' at position %d", ek_to_string[kind], expr.start+1)
+			}
+
+			return kind, nil
+		}
+	}
+
+	return expr.kind, nil
+}
+
+// Kind of the items of a list operand, nil when it cannot be known
+func (c checker_t) listItemKind(expr *expression_t) expression_kind_t {
+	switch expr.kind {
+	case ek_list:
+		return expr.list.kind
+	case ek_lazy_symbol:
+		return dtype_to_ek[data_type_t(c.fields[expr.symbolName]&^listField)]
+	}
+
+	return ek_nil
+}
+
+func (c checker_t) checkQuantifier(expr *expression_t) (expression_kind_t, error) {
+	function := expr.call.function
+	args := expr.call.args
+
+	list, err := c.operandKind(args[0])
+
+	if err != nil {
+		return ek_nil, err
+	}
+
+	if list != ek_list && list != ek_nil {
+		return ek_nil, typeError(expr, "error: you cannot call %s at position %d", callSignature(function, []expression_kind_t{list, ek_bool}), expr.start+1)
+	}
+
+	inner := c
+	inner.item = c.listItemKind(args[0])
+	inner.hasItem = true
+
+	if err := inner.check(args[1]); err != nil {
+		return ek_nil, err
+	}
+
+	return ek_bool, nil
+}
+
+func (c checker_t) checkRange(expr *expression_t, left expression_kind_t) error {
+	interval := expr.binary.right.interval
+
+	low, err := c.operandKind(interval.low)
+
+	if err != nil {
+		return err
+	}
+
+	high, err := c.operandKind(interval.high)
+
+	if err != nil {
+		return err
+	}
+
+	if left != ek_nil && (!canCompare(left, bo_gte, low) || !canCompare(left, bo_lte, high)) {
+		return typeError(expr, "error: you cannot do such operation '%s %s %s..%s' at position %d", ek_to_string[left], bo_to_string[expr.binary.operator], ek_to_string[low], ek_to_string[high], expr.start+1)
+	}
+
+	return nil
+}
+
+func (c checker_t) checkMembership(expr *expression_t) error {
+	binary := expr.binary
+	left, err := c.operandKind(binary.left)
+
+	if err != nil {
+		return err
+	}
+
+	if binary.right.kind == ek_range {
+		return c.checkRange(expr, left)
+	}
+
+	if binary.right.kind == ek_prefix {
+		if left != ek_nil && left != ek_ip {
+			return typeError(expr, "error: you cannot do such operation '%s %s prefix' at position %d", ek_to_string[left], bo_to_string[binary.operator], expr.start+1)
+		}
+
+		return nil
+	}
+
+	list := binary.right.list
+
+	for _, item := range list.items {
+		if _, err := c.operandKind(item); err != nil {
+			return err
+		}
+	}
+
+	if left != ek_nil && len(list.items) > 0 && !canCompare(left, bo_eq, list.kind) {
+		return typeError(expr, "error: you cannot do such operation '%s %s %s list' at position %d", ek_to_string[left], bo_to_string[binary.operator], ek_to_string[list.kind], expr.start+1)
+	}
+
+	return nil
+}
+
+func (c checker_t) checkComparison(expr *expression_t) error {
+	binary := expr.binary
+	left, err := c.operandKind(binary.left)
+
+	if err != nil {
+		return err
+	}
+
+	right, err := c.operandKind(binary.right)
+
+	if err != nil {
+		return err
+	}
+
+	if left == ek_list && binary.operator == bo_contains {
+		item := c.listItemKind(binary.left)
+
+		if item != ek_nil && !canCompare(item, bo_eq, right) {
+			return typeError(expr, "error: you cannot do such operation '%s list contains %s' at position %d", ek_to_string[item], ek_to_string[right], expr.start+1)
+		}
+
+		return nil
+	}
+
+	if !canCompare(left, binary.operator, right) {
+		return typeError(expr, "error: you cannot do such operation '%s %s %s' at position %d", ek_to_string[left], bo_to_string[binary.operator], ek_to_string[right], expr.start+1)
+	}
+
+	return nil
+}
+
+func (c checker_t) check(expr *expression_t) error {
+	if expr == nil {
+		return nil
+	}
+
+	switch expr.kind {
+	case ek_binary:
+		{
+			switch expr.binary.operator {
+			case bo_and, bo_or:
+				{
+					if err := c.check(expr.binary.left); err != nil {
+						return err
+					}
+
+					return c.check(expr.binary.right)
+				}
+			case bo_in, bo_not_in:
+				return c.checkMembership(expr)
+			}
+
+			if !isArithmeticOperator(expr.binary.operator) {
+				return c.checkComparison(expr)
+			}
+		}
+	case ek_unary:
+		if expr.unary.operator == uo_not {
+			return c.check(expr.unary.operand)
+		}
+	case ek_bool:
+		return nil
+	}
+
+	kind, err := c.operandKind(expr)
+
+	if err != nil {
+		return err
+	}
+
+	if kind != ek_bool {
+		return typeError(expr, "error: expected bool but got %s at position %d", ek_to_string[kind], expr.start+1)
+	}
+
+	return nil
+}
+
+// Operators that only make sense between strings
+func isStringOperator(op binary_operator_t) bool {
+	switch op {
+	case bo_reg, bo_contains, bo_startswith, bo_endswith, bo_ieq, bo_icontains, bo_like:
+		return true
+	}
+
+	return false
+}
+
+// Same rules the evaluator applies when comparing two values
+func canCompare(left expression_kind_t, op binary_operator_t, right expression_kind_t) bool {
+	if isStringOperator(op) {
+		return left == ek_string && right == ek_string
+	}
+
+	if left == ek_nil || right == ek_nil {
+		return op == bo_eq || op == bo_ne
+	}
+
+	if isNumberKind(left) && isNumberKind(right) {
+		return true
+	}
+
+	if left != right {
+		return false
+	}
+
+	switch left {
+	case ek_string, ek_time, ek_duration, ek_ip:
+		return true
+	case ek_atom, ek_bool, ek_prefix:
+		return op == bo_eq || op == bo_ne
+	}
+
+	return false
+}
+
+// Kind of the result of an arithmetic operation, the operation is only possible between numbers,
+// times and durations (see `temporalKind`).
+// Integers are promoted to float when the other side is a float, and `/` always results in a float
+func arithmeticKind(left expression_kind_t, op binary_operator_t, right expression_kind_t) (expression_kind_t, bool) {
+	if isTemporalKind(left) || isTemporalKind(right) {
+		return temporalKind(left, op, right)
+	}
+
+	if !isNumberKind(left) || !isNumberKind(right) {
+		return ek_nil, false
+	}
+
+	if op == bo_div || left == ek_float || right == ek_float {
+		return ek_float, true
+	}
+
+	return ek_integer, true
+}
+
+// Reports unknown variables, unknown atoms and impossible comparisons of
+// `query` before any data is processed.
+func Check(query string, schema Schema) error {
+	expr, err := parseQuery(query)
+
+	if err != nil {
+		return err
+	}
+
+	checker, err := createChecker(schema)
+
+	if err != nil {
+		return err
+	}
+
+	return locateError(query, checker.check(expr))
+}
+
+// Same as `Init`, but the query is checked against `schema`,
+// and the atoms of the schema are already set up.
+func InitWithSchema(query string, schema Schema) (*Quang, error) {
+	expr, err := parseQuery(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	checker, err := createChecker(schema)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checker.check(expr); err != nil {
+		return nil, locateError(query, err)
+	}
+
+	evaluator := createEvaluator(expr)
+	evaluator.query = query
+
+	for atom, value := range checker.atoms {
+		evaluator.atoms[atom] = value
+	}
+
+	return &Quang{
+		evaluator: evaluator,
+	}, nil
+}
@@ -0,0 +1,227 @@
+package quang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var check_test_schema = Schema{
+	Fields: map[string]FieldType{
+		"status":  IntegerField,
+		"latency": FloatField,
+		"agent":   StringField,
+		"alive":   BoolField,
+		"method":  AtomField,
+		"tags":    StringListField,
+		"ports":   IntegerListField,
+		"ts":      TimeField,
+		"elapsed": DurationField,
+		"src_ip":  IPField,
+	},
+	Atoms: map[string]AtomType{
+		":get":  0,
+		":post": 1,
+	},
+}
+
+func TestCheckingValidQueries(t *testing.T) {
+	tests := []string{
+		"",
+		"status eq 200",
+		"status gt 1.5 and latency lte 10",
+		"agent reg '^curl' or agent eq nil",
+		"method eq :get and not alive",
+		"alive eq true or (alive and status ne nil)",
+		"nil eq method",
+		"true",
+	}
+
+	for _, test := range tests {
+		assert.Nil(t, Check(test, check_test_schema), "test: %s", test)
+	}
+}
+
+func TestCheckingInvalidQueries(t *testing.T) {
+	tests := map[string]string{
+		"stauts eq 200":                    "error: the variable 'stauts' does not exist at position 1",
+		"status eq 200 and method eq :put": "error: the atom ':put' does not exist at position 29",
+		"method gt 'x'":                    "error: you cannot do such operation 'atom gt string' at position 1",
+		"agent reg 10":                     "error: you cannot do such operation 'string reg integer' at position 1",
+		"status reg '1'":                   "error: you cannot do such operation 'integer reg string' at position 1",
+		"alive gt false":                   "error: you cannot do such operation 'bool gt bool' at position 1",
+		"status gt nil":                    "error: you cannot do such operation 'integer gt nil' at position 1",
+		"true or status":                   "error: expected bool but got integer at position 9",
+		"not agent":                        "error: expected bool but got string at position 5",
+		"method eq :get and 1":             "error: expected bool but got integer at position 20",
+	}
+
+	for test, expected := range tests {
+		err := Check(test, check_test_schema)
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+	}
+
+	err := Check("status eq 1", Schema{Atoms: map[string]AtomType{"get": 0}})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: invalid atom name", err.Error())
+}
+
+func TestInitWithSchema(t *testing.T) {
+	q, err := InitWithSchema("method eq :post and status gte 500", check_test_schema)
+
+	assert.Nil(t, err)
+
+	result, err := q.AddAtomVar("method", 1).AddIntegerVar("status", 503).Eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	q, err = InitWithSchema("method eq :put", check_test_schema)
+
+	assert.Nil(t, q)
+	assert.NotNil(t, err)
+}
+
+func TestCheckingInExpressions(t *testing.T) {
+	assert.Nil(t, Check("status in [500, 503] and method not in [:get]", check_test_schema))
+
+	tests := map[string]string{
+		"agent in [1, 2]":     "error: you cannot do such operation 'string in integer list' at position 1",
+		"method in [:delete]": "error: the atom ':delete' does not exist at position 12",
+	}
+
+	for test, expected := range tests {
+		err := Check(test, check_test_schema)
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+	}
+}
+
+func TestCheckingRangeExpressions(t *testing.T) {
+	assert.Nil(t, Check("status between 200 and 299 and latency in 0..<1.5", check_test_schema))
+
+	err := Check("method between 1 and 2", check_test_schema)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: you cannot do such operation 'atom in integer..integer' at position 1", err.Error())
+}
+
+func TestCheckingArithmeticExpressions(t *testing.T) {
+	assert.Nil(t, Check("status % 100 eq 3 and latency * 1000 gt status and status + 1 in [504]", check_test_schema))
+
+	tests := map[string]string{
+		"agent + 1 gt 1":       "error: you cannot do such operation 'string + integer' at position 1",
+		"status / 2 eq 'x'":    "error: you cannot do such operation 'float eq string' at position 1",
+		"status * 2":           "error: expected bool but got integer at position 1",
+		"alive or latency + 1": "error: expected bool but got float at position 10",
+		"status + stauts gt 1": "error: the variable 'stauts' does not exist at position 10",
+	}
+
+	for test, expected := range tests {
+		err := Check(test, check_test_schema)
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+	}
+}
+
+func TestCheckingNegations(t *testing.T) {
+	assert.Nil(t, Check("-status lt -200 and -latency gt -1e3", check_test_schema))
+
+	tests := map[string]string{
+		"-agent eq 1":        "error: you cannot do such operation '-string' at position 1",
+		"alive and -latency": "error: expected bool but got float at position 11",
+	}
+
+	for test, expected := range tests {
+		err := Check(test, check_test_schema)
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+	}
+}
+
+func TestCheckingCalls(t *testing.T) {
+	assert.Nil(t, Check("len(agent) gt 3 and abs(latency) lt 1.5 and coalesce(agent, 'curl') ne 'wget' and lower(agent) contains 'bot'", check_test_schema))
+
+	tests := map[string]string{
+		"len(status) gt 3":             "error: you cannot call len(integer) at position 1",
+		"coalesce(agent, status) eq 1": "error: you cannot call coalesce(string, integer) at position 1",
+		"abs(latency) eq 'x'":          "error: you cannot do such operation 'float eq string' at position 1",
+		"len(agnet) gt 1":              "error: the variable 'agnet' does not exist at position 5",
+		"alive and len(agent)":         "error: expected bool but got integer at position 11",
+	}
+
+	for test, expected := range tests {
+		err := Check(test, check_test_schema)
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+	}
+}
+
+func TestCheckingLists(t *testing.T) {
+	assert.Nil(t, Check("tags contains 'prod' and ports contains 443 and len(tags) gt 1", check_test_schema))
+	assert.Nil(t, Check("any(tags, _ reg '^team-') and all(ports, _ gt 0 and _ lt 65536)", check_test_schema))
+	assert.Nil(t, Check("any(tags, any(ports, _ eq 80)) or all([1, 2], _ gt status)", check_test_schema))
+
+	tests := map[string]string{
+		"tags contains 1":          "error: you cannot do such operation 'string list contains integer' at position 1",
+		"tags eq 'prod'":           "error: you cannot do such operation 'list eq string' at position 1",
+		"any(agent, _ eq 'a')":     "error: you cannot call any(string, bool) at position 1",
+		"any(ports, _ reg 'a')":    "error: you cannot do such operation 'integer reg string' at position 12",
+		"all(tags, _)":             "error: expected bool but got string at position 11",
+		"all(tags, _ eq 'a') or _": "error: the variable '_' does not exist at position 24",
+	}
+
+	for test, expected := range tests {
+		err := Check(test, check_test_schema)
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+	}
+}
+
+func TestCheckingTimesAndDurations(t *testing.T) {
+	assert.Nil(t, Check("ts gt 2024-05-01T00:00:00Z and elapsed gte 250ms and ts gt now() - 1h", check_test_schema))
+	assert.Nil(t, Check("now() - ts lt elapsed * 2 and -elapsed lt 0s and abs(elapsed) / 1s gt 0.5", check_test_schema))
+
+	tests := map[string]string{
+		"ts gt 1":                "error: you cannot do such operation 'time gt integer' at position 1",
+		"elapsed gt ts":          "error: you cannot do such operation 'duration gt time' at position 1",
+		"ts + ts gt now()":       "error: you cannot do such operation 'time + time' at position 1",
+		"-ts lt now()":           "error: you cannot do such operation '-time' at position 1",
+		"elapsed + 1 gt elapsed": "error: you cannot do such operation 'duration + integer' at position 1",
+		"len(ts) gt 1":           "error: you cannot call len(time) at position 1",
+	}
+
+	for test, expected := range tests {
+		err := Check(test, check_test_schema)
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+	}
+}
+
+func TestCheckingAddresses(t *testing.T) {
+	assert.Nil(t, Check("src_ip in 10.0.0.0/8 and src_ip ne 10.0.0.1 and src_ip not in 2001:db8::/32", check_test_schema))
+	assert.Nil(t, Check("src_ip in 10.0.0.1..10.0.0.9 or src_ip eq nil", check_test_schema))
+
+	tests := map[string]string{
+		"agent in 10.0.0.0/8":   "error: you cannot do such operation 'string in prefix' at position 1",
+		"src_ip eq 'localhost'": "error: you cannot do such operation 'ip eq string' at position 1",
+		"src_ip gt 1":           "error: you cannot do such operation 'ip gt integer' at position 1",
+		"src_ip + 1 gt src_ip":  "error: you cannot do such operation 'ip + integer' at position 1",
+	}
+
+	for test, expected := range tests {
+		err := Check(test, check_test_schema)
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+	}
+}
@@ -0,0 +1,212 @@
+package quang
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Where in the query an error happened.
+// It is embedded in all the errors related to the query, so,
+// whatever the kind of the error, you can get its position.
+type ErrorInfo struct {
+	// Byte offsets of the start and the end (exclusive) of the offending part of the query
+	Offset, End int
+	// 1-based line and column of `Offset`, the column is counted in characters
+	Line, Column int
+	// The offending part of the query, as written in it
+	Token string
+
+	message string
+}
+
+// The query is malformed. For example: unterminated strings, unexpected tokens
+// or invalid regex patterns
+type SyntaxError struct {
+	ErrorInfo
+}
+
+// Two values cannot be compared with such operator, or a non-bool value is used as a condition
+type TypeError struct {
+	ErrorInfo
+}
+
+// The query uses a variable that was not provided
+type UnknownVariableError struct {
+	ErrorInfo
+
+	Name string
+}
+
+// The query uses an atom that was not set up
+type UnknownAtomError struct {
+	ErrorInfo
+
+	Name string
+}
+
+// An arithmetic operation has no result, like a division by zero
+type ArithmeticError struct {
+	ErrorInfo
+}
+
+type located_error_t interface {
+	error
+	errorInfo() *ErrorInfo
+}
+
+func (e *ErrorInfo) Error() string {
+	return e.message
+}
+
+func (e *ErrorInfo) errorInfo() *ErrorInfo {
+	return e
+}
+
+func createErrorInfo(start, end int, format string, args ...any) ErrorInfo {
+	return ErrorInfo{
+		Offset:  start,
+		End:     end,
+		message: fmt.Sprintf(format, args...),
+	}
+}
+
+func syntaxError(start, end int, format string, args ...any) *SyntaxError {
+	return &SyntaxError{
+		ErrorInfo: createErrorInfo(start, end, format, args...),
+	}
+}
+
+func typeError(expr *expression_t, format string, args ...any) *TypeError {
+	return &TypeError{
+		ErrorInfo: createErrorInfo(expr.start, expr.end, format, args...),
+	}
+}
+
+func arithmeticError(expr *expression_t, format string, args ...any) *ArithmeticError {
+	return &ArithmeticError{
+		ErrorInfo: createErrorInfo(expr.start, expr.end, format, args...),
+	}
+}
+
+func unknownVariableError(expr *expression_t, format string, args ...any) *UnknownVariableError {
+	return &UnknownVariableError{
+		ErrorInfo: createErrorInfo(expr.start, expr.end, format, args...),
+		Name:      expr.symbolName,
+	}
+}
+
+func unknownAtomError(expr *expression_t, format string, args ...any) *UnknownAtomError {
+	return &UnknownAtomError{
+		ErrorInfo: createErrorInfo(expr.start, expr.end, format, args...),
+		Name:      expr.symbolName,
+	}
+}
+
+// Computes the line, the column and the token of the error,
+// which are only known once we have the whole query
+func (e *ErrorInfo) locate(query string) {
+	offset := min(max(e.Offset, 0), len(query))
+	end := min(max(e.End, offset), len(query))
+
+	e.Token = query[offset:end]
+
+	e.Line = 1
+	lineStart := 0
+
+	for i := 0; i < offset; i++ {
+		if query[i] == '\n' {
+			e.Line++
+			lineStart = i + 1
+		}
+	}
+
+	e.Column = utf8.RuneCountInString(query[lineStart:offset]) + 1
+}
+
+func locateError(query string, err error) error {
+	var located located_error_t
+
+	if errors.As(err, &located) {
+		located.errorInfo().locate(query)
+	}
+
+	return err
+}
+
+func errorHint(err located_error_t) string {
+	switch err.(type) {
+	case *SyntaxError:
+		return "the query is malformed here"
+	case *TypeError:
+		return "these values cannot be used together like this"
+	case *UnknownVariableError:
+		return "provide this variable before evaluating the query, or check its spelling"
+	case *UnknownAtomError:
+		return "set this atom up with SetupAtom before evaluating the query, or check its spelling"
+	case *ArithmeticError:
+		return "this operation has no result for the values being evaluated"
+	}
+
+	return ""
+}
+
+// Renders `err` for end users, showing the line of `query` where the error is,
+// with the faulty part underlined and a hint, just like compilers do:
+//
+//	error: the variable 'stauts' does not exist
+//	 1 | stauts eq 200
+//	   | ^~~~~~
+//	hint: provide this variable before evaluating the query, or check its spelling
+//
+// Errors that are not related to the query are rendered as is.
+func FormatError(query string, err error) string {
+	var located located_error_t
+
+	if !errors.As(err, &located) {
+		return err.Error()
+	}
+
+	info := located.errorInfo()
+	info.locate(query)
+
+	offset := min(max(info.Offset, 0), len(query))
+	lineStart := strings.LastIndexByte(query[:offset], '\n') + 1
+	lineEnd := len(query)
+
+	if i := strings.IndexByte(query[offset:], '\n'); i >= 0 {
+		lineEnd = offset + i
+	}
+
+	end := min(max(info.End, offset), lineEnd)
+
+	// tabs are kept, so the underline is aligned with the query whatever the tab size is
+	var padding strings.Builder
+
+	for _, c := range query[lineStart:offset] {
+		if c == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+
+	underline := "^"
+
+	if width := utf8.RuneCountInString(query[offset:end]); width > 1 {
+		underline += strings.Repeat("~", width-1)
+	}
+
+	lineNumber := fmt.Sprintf("%d", info.Line)
+	gutter := strings.Repeat(" ", len(lineNumber))
+
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "%s\n", err.Error())
+	fmt.Fprintf(&out, " %s | %s\n", lineNumber, query[lineStart:lineEnd])
+	fmt.Fprintf(&out, " %s | %s%s\n", gutter, padding.String(), underline)
+	fmt.Fprintf(&out, "hint: %s", errorHint(located))
+
+	return out.String()
+}
@@ -0,0 +1,208 @@
+package quang_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/marcos-venicius/quang"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyntaxErrors(t *testing.T) {
+	type test_case_t struct {
+		query   string
+		message string
+		info    quang.ErrorInfo
+	}
+
+	tests := []test_case_t{
+		{
+			query:   "size gt 'abc",
+			message: "error: unterminated string literal at position 9",
+			info:    quang.ErrorInfo{Offset: 8, End: 12, Line: 1, Column: 9, Token: "'abc"},
+		},
+		{
+			query:   "size gt 1 &",
+			message: "error: unexpected character \"&\" at position 11",
+			info:    quang.ErrorInfo{Offset: 10, End: 11, Line: 1, Column: 11, Token: "&"},
+		},
+		{
+			query:   "name eq 'a' and é",
+			message: "error: unexpected character \"é\" at position 17",
+			info:    quang.ErrorInfo{Offset: 16, End: 18, Line: 1, Column: 17, Token: "é"},
+		},
+		{
+			query:   "size gt 1 and (name eq 'x'",
+			message: "error: expected ')' but got end of query",
+			info:    quang.ErrorInfo{Offset: 26, End: 26, Line: 1, Column: 27, Token: ""},
+		},
+		{
+			query:   "size gt 1\nand name 'x'",
+			message: "error: expected comparison operator after expression but got \"x\"",
+			info:    quang.ErrorInfo{Offset: 19, End: 22, Line: 2, Column: 10, Token: "'x'"},
+		},
+		{
+			query:   "(size gt 1) eq true",
+			message: "error: unexpected token \"eq\" at position 13",
+			info:    quang.ErrorInfo{Offset: 12, End: 14, Line: 1, Column: 13, Token: "eq"},
+		},
+		{
+			query:   "name eq 'ção' and\n\tagent reg '(a'",
+			message: "error: invalid regex pattern '(a' at position 32: error parsing regexp: missing closing ): `(a`",
+			info:    quang.ErrorInfo{Offset: 31, End: 35, Line: 2, Column: 12, Token: "'(a'"},
+		},
+	}
+
+	for _, test := range tests {
+		q, err := quang.Init(test.query)
+
+		assert.Nil(t, q)
+
+		var syntaxErr *quang.SyntaxError
+
+		assert.True(t, errors.As(err, &syntaxErr), "query: %s", test.query)
+		assert.Equal(t, test.message, syntaxErr.Error())
+		assert.Equal(t, test.info.Offset, syntaxErr.Offset, "query: %s", test.query)
+		assert.Equal(t, test.info.End, syntaxErr.End, "query: %s", test.query)
+		assert.Equal(t, test.info.Line, syntaxErr.Line, "query: %s", test.query)
+		assert.Equal(t, test.info.Column, syntaxErr.Column, "query: %s", test.query)
+		assert.Equal(t, test.info.Token, syntaxErr.Token, "query: %s", test.query)
+	}
+}
+
+func TestEvaluationErrors(t *testing.T) {
+	q, err := quang.Init("status eq 200 and\n  method eq :get")
+
+	assert.Nil(t, err)
+
+	_, err = q.Eval()
+
+	var variableErr *quang.UnknownVariableError
+
+	assert.True(t, errors.As(err, &variableErr))
+	assert.Equal(t, "status", variableErr.Name)
+	assert.Equal(t, "status", variableErr.Token)
+	assert.Equal(t, 1, variableErr.Line)
+	assert.Equal(t, 1, variableErr.Column)
+
+	_, err = q.AddIntegerVar("status", 200).AddAtomVar("method", 0).Eval()
+
+	var atomErr *quang.UnknownAtomError
+
+	assert.True(t, errors.As(err, &atomErr))
+	assert.Equal(t, ":get", atomErr.Name)
+	assert.Equal(t, ":get", atomErr.Token)
+	assert.Equal(t, 2, atomErr.Line)
+	assert.Equal(t, 13, atomErr.Column)
+
+	_, err = q.AddStringVar("status", "ok").Eval()
+
+	var typeErr *quang.TypeError
+
+	assert.True(t, errors.As(err, &typeErr))
+	assert.Equal(t, "error: you cannot do such operation 'string eq integer'", typeErr.Error())
+	assert.Equal(t, "status eq 200", typeErr.Token)
+	assert.Equal(t, 0, typeErr.Offset)
+	assert.Equal(t, 13, typeErr.End)
+
+	q, err = quang.Init("bytes gt 0 and\n  bytes / size gt 10")
+
+	assert.Nil(t, err)
+
+	_, err = q.AddIntegerVar("bytes", 10).AddIntegerVar("size", 0).Eval()
+
+	var arithmeticErr *quang.ArithmeticError
+
+	assert.True(t, errors.As(err, &arithmeticErr))
+	assert.Equal(t, "error: division by zero", arithmeticErr.Error())
+	assert.Equal(t, "bytes / size", arithmeticErr.Token)
+	assert.Equal(t, 2, arithmeticErr.Line)
+	assert.Equal(t, 3, arithmeticErr.Column)
+}
+
+func TestSchemaErrors(t *testing.T) {
+	schema := quang.Schema{
+		Fields: map[string]quang.FieldType{
+			"method": quang.AtomField,
+		},
+		Atoms: map[string]quang.AtomType{
+			":get": 0,
+		},
+	}
+
+	err := quang.Check("method gt 'x'", schema)
+
+	var typeErr *quang.TypeError
+
+	assert.True(t, errors.As(err, &typeErr))
+	assert.Equal(t, "method gt 'x'", typeErr.Token)
+
+	err = quang.Check("stauts eq 1", schema)
+
+	var variableErr *quang.UnknownVariableError
+
+	assert.True(t, errors.As(err, &variableErr))
+	assert.Equal(t, "stauts", variableErr.Name)
+	assert.Equal(t, 1, variableErr.Column)
+
+	err = quang.Check("method eq :put", schema)
+
+	var atomErr *quang.UnknownAtomError
+
+	assert.True(t, errors.As(err, &atomErr))
+	assert.Equal(t, ":put", atomErr.Name)
+	assert.Equal(t, 11, atomErr.Column)
+}
+
+func TestFormattingErrors(t *testing.T) {
+	query := "stauts eq 200"
+
+	q, err := quang.Init(query)
+
+	assert.Nil(t, err)
+
+	_, err = q.Eval()
+
+	assert.Equal(t, "error: the variable 'stauts' does not exist\n"+
+		" 1 | stauts eq 200\n"+
+		"   | ^~~~~~\n"+
+		"hint: provide this variable before evaluating the query, or check its spelling", quang.FormatError(query, err))
+
+	query = "size gt 1 and\n\t(name eq 'çã' or x &"
+
+	_, err = quang.Init(query)
+
+	assert.Equal(t, "error: unexpected character \"&\" at position 37\n"+
+		" 2 | \t(name eq 'çã' or x &\n"+
+		"   | \t                   ^\n"+
+		"hint: the query is malformed here", quang.FormatError(query, err))
+
+	query = "name eq 'ç' ∧ size gt 1"
+
+	_, err = quang.Init(query)
+
+	assert.Equal(t, "error: unexpected character \"∧\" at position 14\n"+
+		" 1 | name eq 'ç' ∧ size gt 1\n"+
+		"   |             ^\n"+
+		"hint: the query is malformed here", quang.FormatError(query, err))
+
+	query = "(size gt 1"
+
+	_, err = quang.Init(query)
+
+	assert.Equal(t, "error: expected ')' but got end of query\n"+
+		" 1 | (size gt 1\n"+
+		"   |           ^\n"+
+		"hint: the query is malformed here", quang.FormatError(query, err))
+
+	query = "name eq 'ab\ncd"
+
+	_, err = quang.Init(query)
+
+	assert.Equal(t, "error: unterminated string literal at position 9\n"+
+		" 1 | name eq 'ab\n"+
+		"   |         ^~~\n"+
+		"hint: the query is malformed here", quang.FormatError(query, err))
+
+	assert.Equal(t, "boom", quang.FormatError(query, errors.New("boom")))
+}
@@ -2,24 +2,60 @@ package quang
 
 import (
 	"fmt"
+	"math"
+	"net/netip"
 	"regexp"
+	"strings"
+	"time"
 )
 
 type data_type_t int
 type variable_t struct {
 	dtype data_type_t
 
-	bool    bool
-	float   FloatType
-	integer IntegerType
-	atom    AtomType
-	string  string
+	bool     bool
+	float    FloatType
+	integer  IntegerType
+	atom     AtomType
+	string   string
+	time     time.Time
+	duration time.Duration
+	ip       netip.Addr
+
+	// items of lists, all of them have the type `itemType`
+	list     []variable_t
+	itemType data_type_t
+
+	// set when the value could not be bound, like an `uint64` that overflows integer,
+	// it is only reported when the query reads the variable
+	err error
+}
+
+type symbol_table_t map[string]variable_t
+
+type resolved_t struct {
+	variable variable_t
+	ok       bool
 }
 
 type evaluator_t struct {
-	symbols    map[string]variable_t
+	symbols    symbol_table_t
 	atoms      map[string]AtomType
 	expression *expression_t
+	query      string
+
+	// when set, variables are resolved by it instead of read from `symbols`
+	resolver Resolver
+
+	// the variables already asked to the resolver in the current evaluation,
+	// so each one is resolved only once, no matter how many times the query reads it
+	resolved map[string]resolved_t
+
+	// the item being checked by `any` and `all`, named `_` in the query
+	item *expression_t
+
+	// tells the current time to `now()`, `time.Now` when not set
+	clock func() time.Time
 }
 
 const (
@@ -29,114 +65,292 @@ const (
 	dtype_bool
 	dtype_atom
 	dtype_nil
+	dtype_list
+	dtype_time
+	dtype_duration
+	dtype_ip
 )
 
 var dtype_to_string = map[data_type_t]string{
-	dtype_integer: "integer",
-	dtype_float:   "float",
-	dtype_string:  "string",
-	dtype_bool:    "bool",
-	dtype_atom:    "atom",
-	dtype_nil:     "nil",
+	dtype_integer:  "integer",
+	dtype_float:    "float",
+	dtype_string:   "string",
+	dtype_bool:     "bool",
+	dtype_atom:     "atom",
+	dtype_nil:      "nil",
+	dtype_list:     "list",
+	dtype_time:     "time",
+	dtype_duration: "duration",
+	dtype_ip:       "ip",
 }
 
 func createEvaluator(expression *expression_t) evaluator_t {
 	return evaluator_t{
-		symbols:    make(map[string]variable_t),
+		symbols:    make(symbol_table_t),
 		atoms:      make(map[string]AtomType),
 		expression: expression,
 	}
 }
 
-func (e *evaluator_t) addStringVar(name, value string) {
-	e.symbols[name] = variable_t{
+func (s symbol_table_t) addStringVar(name, value string) {
+	s[name] = variable_t{
 		dtype:  dtype_string,
 		string: value,
 	}
 }
 
-func (e *evaluator_t) addIntegerVar(name string, value IntegerType) {
-	e.symbols[name] = variable_t{
+func (s symbol_table_t) addIntegerVar(name string, value IntegerType) {
+	s[name] = variable_t{
 		dtype:   dtype_integer,
 		integer: value,
 	}
 }
 
-func (e *evaluator_t) addFloatVar(name string, value FloatType) {
-	e.symbols[name] = variable_t{
+func (s symbol_table_t) addFloatVar(name string, value FloatType) {
+	s[name] = variable_t{
 		dtype: dtype_float,
 		float: value,
 	}
 }
 
-func (e *evaluator_t) addBoolVar(name string, value bool) {
-	e.symbols[name] = variable_t{
+func (s symbol_table_t) addBoolVar(name string, value bool) {
+	s[name] = variable_t{
 		dtype: dtype_bool,
 		bool:  value,
 	}
 }
 
-func (e *evaluator_t) addAtomVar(name string, value AtomType) {
-	e.symbols[name] = variable_t{
+func (s symbol_table_t) addAtomVar(name string, value AtomType) {
+	s[name] = variable_t{
 		dtype: dtype_atom,
 		atom:  value,
 	}
 }
 
-func (e *evaluator_t) setAtomValue(name string, value AtomType) error {
+func (s symbol_table_t) addNilVar(name string) {
+	s[name] = variable_t{
+		dtype: dtype_nil,
+	}
+}
+
+func (s symbol_table_t) addTimeVar(name string, value time.Time) {
+	s[name] = variable_t{
+		dtype: dtype_time,
+		time:  value,
+	}
+}
+
+func (s symbol_table_t) addDurationVar(name string, value time.Duration) {
+	s[name] = variable_t{
+		dtype:    dtype_duration,
+		duration: value,
+	}
+}
+
+// IPv4-mapped IPv6 addresses, like `::ffff:10.0.0.1`, are stored as IPv4
+func (s symbol_table_t) addIPVar(name string, value netip.Addr) {
+	s[name] = variable_t{
+		dtype: dtype_ip,
+		ip:    value.Unmap(),
+	}
+}
+
+func stringListVariable(values []string) variable_t {
+	list := make([]variable_t, 0, len(values))
+
+	for _, value := range values {
+		list = append(list, variable_t{dtype: dtype_string, string: value})
+	}
+
+	return variable_t{dtype: dtype_list, itemType: dtype_string, list: list}
+}
+
+func (s symbol_table_t) addStringListVar(name string, values []string) {
+	s[name] = stringListVariable(values)
+}
+
+func integerListVariable(values []IntegerType) variable_t {
+	list := make([]variable_t, 0, len(values))
+
+	for _, value := range values {
+		list = append(list, variable_t{dtype: dtype_integer, integer: value})
+	}
+
+	return variable_t{dtype: dtype_list, itemType: dtype_integer, list: list}
+}
+
+func (s symbol_table_t) addIntegerListVar(name string, values []IntegerType) {
+	s[name] = integerListVariable(values)
+}
+
+func floatListVariable(values []FloatType) variable_t {
+	list := make([]variable_t, 0, len(values))
+
+	for _, value := range values {
+		list = append(list, variable_t{dtype: dtype_float, float: value})
+	}
+
+	return variable_t{dtype: dtype_list, itemType: dtype_float, list: list}
+}
+
+func (s symbol_table_t) addFloatListVar(name string, values []FloatType) {
+	s[name] = floatListVariable(values)
+}
+
+func atomListVariable(values []AtomType) variable_t {
+	list := make([]variable_t, 0, len(values))
+
+	for _, value := range values {
+		list = append(list, variable_t{dtype: dtype_atom, atom: value})
+	}
+
+	return variable_t{dtype: dtype_list, itemType: dtype_atom, list: list}
+}
+
+func (s symbol_table_t) addAtomListVar(name string, values []AtomType) {
+	s[name] = atomListVariable(values)
+}
+
+func (e *evaluator_t) addStringVar(name, value string) {
+	e.symbols.addStringVar(name, value)
+}
+
+func (e *evaluator_t) addIntegerVar(name string, value IntegerType) {
+	e.symbols.addIntegerVar(name, value)
+}
+
+func (e *evaluator_t) addFloatVar(name string, value FloatType) {
+	e.symbols.addFloatVar(name, value)
+}
+
+func (e *evaluator_t) addBoolVar(name string, value bool) {
+	e.symbols.addBoolVar(name, value)
+}
+
+func (e *evaluator_t) addAtomVar(name string, value AtomType) {
+	e.symbols.addAtomVar(name, value)
+}
+
+func (e *evaluator_t) addNilVar(name string) {
+	e.symbols.addNilVar(name)
+}
+
+func (e *evaluator_t) addTimeVar(name string, value time.Time) {
+	e.symbols.addTimeVar(name, value)
+}
+
+func (e *evaluator_t) addDurationVar(name string, value time.Duration) {
+	e.symbols.addDurationVar(name, value)
+}
+
+func (e *evaluator_t) addIPVar(name string, value netip.Addr) {
+	e.symbols.addIPVar(name, value)
+}
+
+func (e *evaluator_t) now() time.Time {
+	if e.clock != nil {
+		return e.clock()
+	}
+
+	return time.Now()
+}
+
+func (e *evaluator_t) addStringListVar(name string, values []string) {
+	e.symbols.addStringListVar(name, values)
+}
+
+func (e *evaluator_t) addIntegerListVar(name string, values []IntegerType) {
+	e.symbols.addIntegerListVar(name, values)
+}
+
+func (e *evaluator_t) addFloatListVar(name string, values []FloatType) {
+	e.symbols.addFloatListVar(name, values)
+}
+
+func (e *evaluator_t) addAtomListVar(name string, values []AtomType) {
+	e.symbols.addAtomListVar(name, values)
+}
+
+func parseAtomName(name string) (string, error) {
 	l := createLexer(name)
 
 	if err := l.lex(); err != nil {
-		return err
+		return "", err
 	}
 
 	if len(l.tokens) == 0 {
-		return fmt.Errorf("error: missing atom name")
+		return "", fmt.Errorf("error: missing atom name")
 	}
 
 	if l.tokens[0].kind != tk_atom {
-		return fmt.Errorf("error: invalid atom name")
+		return "", fmt.Errorf("error: invalid atom name")
+	}
+
+	return l.tokens[0].value, nil
+}
+
+func (e *evaluator_t) setAtomValue(name string, value AtomType) error {
+	atom, err := parseAtomName(name)
+
+	if err != nil {
+		return err
 	}
 
-	e.atoms[l.tokens[0].value] = value
+	e.atoms[atom] = value
 
 	return nil
 }
 
+func (e *evaluator_t) lookupVar(name string) (variable_t, bool, error) {
+	if e.resolver != nil {
+		if resolved, ok := e.resolved[name]; ok {
+			return resolved.variable, resolved.ok, nil
+		}
+
+		value, ok, err := e.resolver.Resolve(name)
+
+		if err != nil {
+			return value.variable, ok, err
+		}
+
+		e.resolved[name] = resolved_t{variable: value.variable, ok: ok}
+
+		return value.variable, ok, nil
+	}
+
+	variable, ok := e.symbols[name]
+
+	return variable, ok, variable.err
+}
+
 func (e *evaluator_t) lazyEvalVar(expr *expression_t) (*expression_t, error) {
+	if expr.kind == ek_binary && isArithmeticOperator(expr.binary.operator) {
+		return e.evaluateArithmetic(expr)
+	}
+
+	if expr.kind == ek_unary && expr.unary.operator == uo_neg {
+		return e.evaluateNegation(expr)
+	}
+
+	if expr.kind == ek_call {
+		return e.evaluateCall(expr)
+	}
+
+	if e.isItem(expr) {
+		return e.item, nil
+	}
+
 	if expr.kind == ek_lazy_symbol {
-		if variable, ok := e.symbols[expr.symbolName]; ok {
-			switch variable.dtype {
-			case dtype_string:
-				return &expression_t{
-					kind:   ek_string,
-					string: variable.string,
-				}, nil
-			case dtype_integer:
-				return &expression_t{
-					kind:    ek_integer,
-					integer: variable.integer,
-				}, nil
-			case dtype_float:
-				return &expression_t{
-					kind:  ek_float,
-					float: variable.float,
-				}, nil
-			case dtype_bool:
-				return &expression_t{
-					kind: ek_bool,
-					bool: variable.bool,
-				}, nil
-			case dtype_atom:
-				return &expression_t{
-					kind: ek_atom,
-					atom: variable.atom,
-				}, nil
-			default:
-				return nil, fmt.Errorf("error: could not lazy evaluate type %s", dtype_to_string[variable.dtype])
-			}
+		variable, ok, err := e.lookupVar(expr.symbolName)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return variableToExpression(variable)
 		} else {
-			return nil, fmt.Errorf("error: the variable '%s' does not exist", expr.symbolName)
+			return nil, unknownVariableError(expr, "error: the variable '%s' does not exist", expr.symbolName)
 		}
 	}
 
@@ -147,14 +361,115 @@ func (e *evaluator_t) lazyEvalVar(expr *expression_t) (*expression_t, error) {
 				atom: atom,
 			}, nil
 		} else {
-			return nil, fmt.Errorf("error: the atom '%s' does not exist", expr.symbolName)
+			return nil, unknownAtomError(expr, "error: the atom '%s' does not exist", expr.symbolName)
 		}
 	}
 
 	return expr, nil
 }
 
-// TODO: eval expressions between float|integer and float|integer
+func variableToExpression(variable variable_t) (*expression_t, error) {
+	switch variable.dtype {
+	case dtype_string:
+		return &expression_t{
+			kind:   ek_string,
+			string: variable.string,
+		}, nil
+	case dtype_integer:
+		return &expression_t{
+			kind:    ek_integer,
+			integer: variable.integer,
+		}, nil
+	case dtype_float:
+		return &expression_t{
+			kind:  ek_float,
+			float: variable.float,
+		}, nil
+	case dtype_bool:
+		return &expression_t{
+			kind: ek_bool,
+			bool: variable.bool,
+		}, nil
+	case dtype_atom:
+		return &expression_t{
+			kind: ek_atom,
+			atom: variable.atom,
+		}, nil
+	case dtype_nil:
+		return &expression_t{
+			kind: ek_nil,
+		}, nil
+	case dtype_time:
+		return &expression_t{
+			kind: ek_time,
+			time: variable.time,
+		}, nil
+	case dtype_duration:
+		return &expression_t{
+			kind:     ek_duration,
+			duration: variable.duration,
+		}, nil
+	case dtype_ip:
+		return &expression_t{
+			kind: ek_ip,
+			ip:   variable.ip,
+		}, nil
+	case dtype_list:
+		return listToExpression(variable), nil
+	default:
+		return nil, fmt.Errorf("error: could not lazy evaluate type %s", dtype_to_string[variable.dtype])
+	}
+}
+
+// Inside `any` and `all`, `_` is the item being checked
+func (e *evaluator_t) isItem(expr *expression_t) bool {
+	return e.item != nil && expr.kind == ek_lazy_symbol && expr.symbolName == "_"
+}
+
+func listToExpression(variable variable_t) *expression_t {
+	list := &list_expression_t{
+		items: make([]*expression_t, 0, len(variable.list)),
+		kind:  dtype_to_ek[variable.itemType],
+	}
+
+	for _, item := range variable.list {
+		list.items = append(list.items, &expression_t{
+			kind:    list.kind,
+			integer: item.integer,
+			float:   item.float,
+			string:  item.string,
+			atom:    item.atom,
+		})
+	}
+
+	return &expression_t{
+		kind: ek_list,
+		list: list,
+	}
+}
+
+// Same as lazyEvalVar, but variables that were never registered are
+// evaluated to nil instead of failing. Used when comparing against `nil`.
+func (e *evaluator_t) lazyEvalNilableVar(expr *expression_t) (*expression_t, error) {
+	if expr.kind == ek_lazy_symbol && !e.isItem(expr) {
+		variable, ok, err := e.lookupVar(expr.symbolName)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return &expression_t{
+				kind: ek_nil,
+			}, nil
+		}
+
+		return variableToExpression(variable)
+	}
+
+	return e.lazyEvalVar(expr)
+}
+
 func (e *evaluator_t) evaluateExpression(expr *expression_t) (bool, error) {
 	if expr == nil {
 		return true, nil
@@ -164,84 +479,580 @@ func (e *evaluator_t) evaluateExpression(expr *expression_t) (bool, error) {
 	case ek_binary:
 		{
 			op := expr.binary.operator
-			left, err := e.lazyEvalVar(expr.binary.left)
 
-			if err != nil {
-				return false, err
-			}
+			switch op {
+			case bo_eq, bo_ne, bo_gt, bo_lt, bo_gte, bo_lte, bo_reg, bo_contains, bo_startswith, bo_endswith, bo_ieq, bo_icontains, bo_like:
+				{
+					resolve := e.lazyEvalVar
 
-			right, err := e.lazyEvalVar(expr.binary.right)
+					if isNilComparison(expr.binary) {
+						resolve = e.lazyEvalNilableVar
+					}
 
-			if err != nil {
-				return false, err
-			}
+					left, err := resolve(expr.binary.left)
 
-			switch op {
-			case bo_eq, bo_ne, bo_gt, bo_lt, bo_gte, bo_lte, bo_reg:
-				{
-					if left.kind == ek_integer && right.kind == ek_integer {
-						return cmpIntegerToInteger(left.integer, op, right.integer)
+					if err != nil {
+						return false, err
 					}
 
-					if left.kind == ek_float && right.kind == ek_float {
-						return cmpFloatToFloat(left.float, op, right.float)
+					right, err := resolve(expr.binary.right)
+
+					if err != nil {
+						return false, err
 					}
 
-					if left.kind == ek_string && right.kind == ek_string {
-						return cmpStringToString(left.string, op, right.string)
+					if left.kind == ek_list && op == bo_contains {
+						return e.evaluateListContains(expr, left, right)
 					}
 
-					if left.kind == ek_atom && right.kind == ek_atom {
-						return cmpAtomToAtom(left.atom, op, right.atom)
+					return compare(expr, left, op, right)
+				}
+			case bo_in, bo_not_in:
+				{
+					found, err := e.evaluateMembership(expr)
+
+					if err != nil {
+						return false, err
 					}
 
-					return false, fmt.Errorf("error: you cannot do such operation '%s %s %s'", ek_to_string[left.kind], bo_to_string[op], ek_to_string[right.kind])
+					return found == (op == bo_in), nil
 				}
+			// `and` and `or` are short-circuited, the right side is only evaluated
+			// when the left side does not decide the result by itself
 			case bo_or:
 				{
-					leftValue, err := e.evaluateExpression(left)
+					leftValue, err := e.evaluateExpression(expr.binary.left)
 
 					if err != nil {
 						return false, err
 					}
 
-					rightValue, err := e.evaluateExpression(right)
+					if leftValue {
+						return true, nil
+					}
+
+					return e.evaluateExpression(expr.binary.right)
+				}
+			case bo_and:
+				{
+					leftValue, err := e.evaluateExpression(expr.binary.left)
 
 					if err != nil {
 						return false, err
 					}
 
-					return leftValue || rightValue, nil
+					if !leftValue {
+						return false, nil
+					}
+
+					return e.evaluateExpression(expr.binary.right)
 				}
-			case bo_and:
+			case bo_add, bo_sub, bo_mul, bo_div, bo_mod:
+				{
+					value, err := e.evaluateArithmetic(expr)
+
+					if err != nil {
+						return false, err
+					}
+
+					return false, typeError(expr, "error: expected bool but got %s", ek_to_string[value.kind])
+				}
+			}
+		}
+	case ek_unary:
+		{
+			switch expr.unary.operator {
+			case uo_not:
 				{
-					leftValue, err := e.evaluateExpression(left)
+					value, err := e.evaluateExpression(expr.unary.operand)
 
 					if err != nil {
 						return false, err
 					}
 
-					rightValue, err := e.evaluateExpression(right)
+					return !value, nil
+				}
+			case uo_neg:
+				{
+					value, err := e.evaluateNegation(expr)
 
 					if err != nil {
 						return false, err
 					}
 
-					return leftValue && rightValue, nil
+					return false, typeError(expr, "error: expected bool but got %s", ek_to_string[value.kind])
 				}
 			}
 		}
+	case ek_lazy_symbol:
+		{
+			value, err := e.lazyEvalVar(expr)
+
+			if err != nil {
+				return false, err
+			}
+
+			if value.kind != ek_bool {
+				return false, typeError(expr, "error: the variable '%s' is %s, expected bool", expr.symbolName, ek_to_string[value.kind])
+			}
+
+			return value.bool, nil
+		}
+	case ek_call:
+		{
+			value, err := e.evaluateCall(expr)
+
+			if err != nil {
+				return false, err
+			}
+
+			if value.kind != ek_bool {
+				return false, typeError(expr, "error: the function '%s' returned %s, expected bool", expr.symbolName, ek_to_string[value.kind])
+			}
+
+			return value.bool, nil
+		}
 	case ek_bool:
 		{
 			return expr.bool, nil
 		}
 	}
 
-	return false, fmt.Errorf("error: could not parse expression kind %s", ek_to_string[expr.kind])
+	return false, typeError(expr, "error: could not parse expression kind %s", ek_to_string[expr.kind])
+}
+
+// Compares two values that were already lazy evaluated.
+// `expr` is the expression being evaluated, used to report errors
+func compare(expr *expression_t, left *expression_t, op binary_operator_t, right *expression_t) (bool, error) {
+	if !canCompare(left.kind, op, right.kind) {
+		return false, typeError(expr, "error: you cannot do such operation '%s %s %s'", ek_to_string[left.kind], bo_to_string[op], ek_to_string[right.kind])
+	}
+
+	if left.kind == ek_nil || right.kind == ek_nil {
+		return cmpNil(left, op, right)
+	}
+
+	if left.kind == ek_integer && right.kind == ek_integer {
+		return cmpIntegerToInteger(left.integer, op, right.integer)
+	}
+
+	if isNumber(left) && isNumber(right) {
+		return cmpFloatToFloat(toFloat(left), op, toFloat(right))
+	}
+
+	if left.kind == ek_string && right.kind == ek_string && op == bo_reg {
+		return matchRegex(expr, left.string, right)
+	}
+
+	if left.kind == ek_string && right.kind == ek_string && op == bo_like {
+		return matchGlob(expr, left.string, right)
+	}
+
+	if left.kind == ek_string && right.kind == ek_string {
+		return cmpStringToString(left.string, op, right.string)
+	}
+
+	if left.kind == ek_atom && right.kind == ek_atom {
+		return cmpAtomToAtom(left.atom, op, right.atom)
+	}
+
+	if left.kind == ek_bool && right.kind == ek_bool {
+		return cmpBoolToBool(left.bool, op, right.bool)
+	}
+
+	if left.kind == ek_time && right.kind == ek_time {
+		return cmpTimeToTime(left.time, op, right.time)
+	}
+
+	if left.kind == ek_duration && right.kind == ek_duration {
+		return cmpDurationToDuration(left.duration, op, right.duration)
+	}
+
+	if left.kind == ek_ip && right.kind == ek_ip {
+		return cmpIPToIP(left.ip, op, right.ip)
+	}
+
+	if left.kind == ek_prefix && right.kind == ek_prefix {
+		return cmpPrefixToPrefix(left.prefix, op, right.prefix)
+	}
+
+	panic("unreacheable: comparison between compatible kinds")
+}
+
+func (e *evaluator_t) evaluateArithmetic(expr *expression_t) (*expression_t, error) {
+	op := expr.binary.operator
+
+	left, err := e.lazyEvalVar(expr.binary.left)
+
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := e.lazyEvalVar(expr.binary.right)
+
+	if err != nil {
+		return nil, err
+	}
+
+	kind, ok := arithmeticKind(left.kind, op, right.kind)
+
+	if !ok {
+		return nil, typeError(expr, "error: you cannot do such operation '%s %s %s'", ek_to_string[left.kind], bo_to_string[op], ek_to_string[right.kind])
+	}
+
+	if isTemporalKind(left.kind) || isTemporalKind(right.kind) {
+		return calcTemporal(expr, left, op, right)
+	}
+
+	result := &expression_t{
+		kind:  kind,
+		start: expr.start,
+		end:   expr.end,
+	}
+
+	if (op == bo_div || op == bo_mod) && toFloat(right) == 0 {
+		return nil, arithmeticError(expr, "error: division by zero")
+	}
+
+	if kind == ek_integer {
+		integer, ok := calcInteger(left.integer, op, right.integer)
+
+		if !ok {
+			return nil, arithmeticError(expr, "error: %d %s %d overflows integer", left.integer, bo_to_string[op], right.integer)
+		}
+
+		result.integer = integer
+	} else {
+		result.float = calcFloat(toFloat(left), op, toFloat(right))
+	}
+
+	return result, nil
+}
+
+func (e *evaluator_t) evaluateNegation(expr *expression_t) (*expression_t, error) {
+	operand, err := e.lazyEvalVar(expr.unary.operand)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch operand.kind {
+	case ek_integer:
+		if operand.integer == math.MinInt64 {
+			return nil, arithmeticError(expr, "error: -(%d) overflows integer", operand.integer)
+		}
+
+		return &expression_t{kind: ek_integer, start: expr.start, end: expr.end, integer: -operand.integer}, nil
+	case ek_float:
+		return &expression_t{kind: ek_float, start: expr.start, end: expr.end, float: -operand.float}, nil
+	case ek_duration:
+		return &expression_t{kind: ek_duration, start: expr.start, end: expr.end, duration: -operand.duration}, nil
+	}
+
+	return nil, typeError(expr, "error: you cannot do such operation '-%s'", ek_to_string[operand.kind])
+}
+
+func (e *evaluator_t) evaluateCall(expr *expression_t) (*expression_t, error) {
+	function := expr.call.function
+
+	if function.predicate {
+		return e.evaluateQuantifier(expr)
+	}
+
+	resolve := e.lazyEvalVar
+
+	if function.nilable {
+		resolve = e.lazyEvalNilableVar
+	}
+
+	args := make([]*expression_t, 0, len(expr.call.args))
+	kinds := make([]expression_kind_t, 0, len(expr.call.args))
+
+	for _, arg := range expr.call.args {
+		value, err := resolve(arg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, value)
+		kinds = append(kinds, value.kind)
+	}
+
+	if _, ok := function.kind(kinds); !ok {
+		return nil, typeError(expr, "error: you cannot call %s", callSignature(function, kinds))
+	}
+
+	return function.call(e, expr, args)
+}
+
+// `any(list, condition)` and `all(list, condition)`, the condition is evaluated
+// for each item, until one of them decides the result
+func (e *evaluator_t) evaluateQuantifier(expr *expression_t) (*expression_t, error) {
+	function := expr.call.function
+
+	list, err := e.lazyEvalVar(expr.call.args[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if list.kind != ek_list && list.kind != ek_nil {
+		return nil, typeError(expr, "error: you cannot call %s", callSignature(function, []expression_kind_t{list.kind, ek_bool}))
+	}
+
+	result := &expression_t{kind: ek_bool, bool: function.every}
+
+	if list.kind == ek_nil {
+		return result, nil
+	}
+
+	// quantifiers can be nested, the outer item is back once the inner quantifier is done
+	outer := e.item
+
+	defer func() {
+		e.item = outer
+	}()
+
+	items, err := e.evaluateListItems(list.list)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		e.item = item
+
+		matches, err := e.evaluateExpression(expr.call.args[1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		if matches != function.every {
+			result.bool = matches
+
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func (e *evaluator_t) evaluateListContains(expr *expression_t, left *expression_t, right *expression_t) (bool, error) {
+	list := left.list
+
+	if len(list.items) == 0 {
+		return false, nil
+	}
+
+	if !canCompare(list.kind, bo_eq, right.kind) {
+		return false, typeError(expr, "error: you cannot do such operation '%s list contains %s'", ek_to_string[list.kind], ek_to_string[right.kind])
+	}
+
+	items, err := e.evaluateListItems(list)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, item := range items {
+		found, err := compare(expr, item, bo_eq, right)
+
+		if err != nil || found {
+			return found, err
+		}
+	}
+
+	return false, nil
+}
+
+func (e *evaluator_t) evaluateMembership(expr *expression_t) (bool, error) {
+	left, err := e.lazyEvalVar(expr.binary.left)
+
+	if err != nil {
+		return false, err
+	}
+
+	if expr.binary.right.kind == ek_range {
+		return e.evaluateRange(expr, left)
+	}
+
+	if expr.binary.right.kind == ek_prefix {
+		return prefixContains(expr, left, expr.binary.right)
+	}
+
+	list := expr.binary.right.list
+
+	if left.kind == ek_nil || len(list.items) == 0 {
+		return false, nil
+	}
+
+	if !canCompare(left.kind, bo_eq, list.kind) {
+		return false, typeError(expr, "error: you cannot do such operation '%s %s %s list'", ek_to_string[left.kind], bo_to_string[expr.binary.operator], ek_to_string[list.kind])
+	}
+
+	if list.set != nil {
+		_, ok := list.set[setKey(left)]
+
+		return ok, nil
+	}
+
+	items, err := e.evaluateListItems(list)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, item := range items {
+		if item.atom == left.atom {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Atoms of list literals are only known when evaluating, all of them are resolved
+// before comparing, so an unknown atom fails no matter where it is in the list
+func (e *evaluator_t) evaluateListItems(list *list_expression_t) ([]*expression_t, error) {
+	if list.kind != ek_atom {
+		return list.items, nil
+	}
+
+	items := make([]*expression_t, 0, len(list.items))
+
+	for _, item := range list.items {
+		value, err := e.lazyEvalVar(item)
+
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, value)
+	}
+
+	return items, nil
+}
+
+func (e *evaluator_t) evaluateRange(expr *expression_t, left *expression_t) (bool, error) {
+	interval := expr.binary.right.interval
+
+	low, err := e.lazyEvalVar(interval.low)
+
+	if err != nil {
+		return false, err
+	}
+
+	high, err := e.lazyEvalVar(interval.high)
+
+	if err != nil {
+		return false, err
+	}
+
+	if left.kind == ek_nil {
+		return false, nil
+	}
+
+	if !canCompare(left.kind, bo_gte, low.kind) || !canCompare(left.kind, bo_lte, high.kind) {
+		return false, typeError(expr, "error: you cannot do such operation '%s %s %s..%s'", ek_to_string[left.kind], bo_to_string[expr.binary.operator], ek_to_string[low.kind], ek_to_string[high.kind])
+	}
+
+	aboveLow, err := compare(expr, left, bo_gte, low)
+
+	if err != nil || !aboveLow {
+		return false, err
+	}
+
+	if interval.exclusive {
+		return compare(expr, left, bo_lt, high)
+	}
+
+	return compare(expr, left, bo_lte, high)
 }
 
 func (e *evaluator_t) eval() (bool, error) {
-	return e.evaluateExpression(e.expression)
+	result, err := e.evaluateExpression(e.expression)
+
+	if err != nil {
+		return false, locateError(e.query, err)
+	}
+
+	return result, nil
+}
+
+func (e *evaluator_t) evalResolver(resolver Resolver) (bool, error) {
+	e.resolver = resolver
+	e.resolved = make(map[string]resolved_t)
+
+	defer func() {
+		e.resolver = nil
+		e.resolved = nil
+	}()
+
+	return e.eval()
+}
+
+func (e *evaluator_t) evalMap(record map[string]any) (bool, error) {
+	return e.evalResolver(map_resolver_t(record))
+}
+
+func isNumberKind(kind expression_kind_t) bool {
+	return kind == ek_integer || kind == ek_float
+}
+
+func isNumber(expr *expression_t) bool {
+	return isNumberKind(expr.kind)
+}
+
+// Integers are promoted to floats when compared against floats, so
+// the user does not need to care about which numeric type a variable is
+func toFloat(expr *expression_t) FloatType {
+	if expr.kind == ek_integer {
+		return FloatType(expr.integer)
+	}
+
+	return expr.float
+}
+
+// A comparison is a nil comparison when `nil` is written literally
+// in one of its sides, for example: `name eq nil`
+func isNilComparison(binary *binary_expression_t) bool {
+	if binary.operator != bo_eq && binary.operator != bo_ne {
+		return false
+	}
+
+	return binary.left.kind == ek_nil || binary.right.kind == ek_nil
+}
+
+// Nil represents all kinds of empty values, so empty strings are nil too.
+// Zero is not considered empty.
+func isEmptyValue(expr *expression_t) bool {
+	switch expr.kind {
+	case ek_nil:
+		return true
+	case ek_string:
+		return expr.string == ""
+	case ek_list:
+		return len(expr.list.items) == 0
+	case ek_ip:
+		return !expr.ip.IsValid()
+	}
+
+	return false
+}
+
+func cmpNil(left *expression_t, op binary_operator_t, right *expression_t) (bool, error) {
+	equal := isEmptyValue(left) == isEmptyValue(right)
+
+	switch op {
+	case bo_eq:
+		return equal, nil
+	case bo_ne:
+		return !equal, nil
+	}
+
+	return false, fmt.Errorf("you cannot do such operation '%s %s %s'", ek_to_string[left.kind], bo_to_string[op], ek_to_string[right.kind])
 }
 
 func cmpIntegerToInteger(left IntegerType, op binary_operator_t, right IntegerType) (bool, error) {
@@ -296,15 +1107,112 @@ func cmpStringToString(left string, op binary_operator_t, right string) (bool, e
 		return left >= right, nil
 	case bo_lte:
 		return left <= right, nil
-	case bo_reg:
-		regex := regexp.MustCompile(right)
-
-		return regex.MatchString(left), nil
+	case bo_contains:
+		return strings.Contains(left, right), nil
+	case bo_startswith:
+		return strings.HasPrefix(left, right), nil
+	case bo_endswith:
+		return strings.HasSuffix(left, right), nil
+	case bo_ieq:
+		return strings.EqualFold(left, right), nil
+	case bo_icontains:
+		return strings.Contains(strings.ToLower(left), strings.ToLower(right)), nil
 	}
 
 	return false, fmt.Errorf("you cannot do such operation 'string %s string'", bo_to_string[op])
 }
 
+// Literal patterns are compiled once by the parser, patterns that
+// come from variables can only be compiled at evaluation time
+func matchRegex(expr *expression_t, left string, right *expression_t) (bool, error) {
+	regex := right.regex
+
+	if regex == nil {
+		compiled, err := regexp.Compile(right.string)
+
+		if err != nil {
+			pattern := expr.binary.right
+
+			return false, syntaxError(pattern.start, pattern.end, "error: invalid regex pattern '%s': %s", right.string, err.Error())
+		}
+
+		regex = compiled
+	}
+
+	return regex.MatchString(left), nil
+}
+
+func matchGlob(expr *expression_t, left string, right *expression_t) (bool, error) {
+	glob := right.regex
+
+	if glob == nil {
+		compiled, err := compileGlob(right.string)
+
+		if err != nil {
+			pattern := expr.binary.right
+
+			return false, syntaxError(pattern.start, pattern.end, "error: invalid glob pattern '%s': %s", right.string, err.Error())
+		}
+
+		glob = compiled
+	}
+
+	return glob.MatchString(left), nil
+}
+
+// Returns false when the result does not fit an integer
+func calcInteger(left IntegerType, op binary_operator_t, right IntegerType) (IntegerType, bool) {
+	switch op {
+	case bo_add:
+		{
+			result := left + right
+
+			return result, (right >= 0) == (result >= left)
+		}
+	case bo_sub:
+		{
+			result := left - right
+
+			return result, (right >= 0) == (result <= left)
+		}
+	case bo_mul:
+		{
+			if left == 0 || right == 0 {
+				return 0, true
+			}
+
+			if (left == -1 && right == math.MinInt64) || (right == -1 && left == math.MinInt64) {
+				return 0, false
+			}
+
+			result := left * right
+
+			return result, result/right == left
+		}
+	case bo_mod:
+		return left % right, true
+	}
+
+	panic("unreacheable: invalid integer arithmetic operator")
+}
+
+func calcFloat(left FloatType, op binary_operator_t, right FloatType) FloatType {
+	switch op {
+	case bo_add:
+		return left + right
+	case bo_sub:
+		return left - right
+	case bo_mul:
+		return left * right
+	case bo_div:
+		return left / right
+	case bo_mod:
+		return FloatType(math.Mod(float64(left), float64(right)))
+	}
+
+	panic("unreacheable: invalid float arithmetic operator")
+}
+
 func cmpAtomToAtom(left AtomType, op binary_operator_t, right AtomType) (bool, error) {
 	switch op {
 	case bo_eq:
@@ -315,3 +1223,14 @@ func cmpAtomToAtom(left AtomType, op binary_operator_t, right AtomType) (bool, e
 
 	return false, fmt.Errorf("you cannot do such operation 'atom %s atom'", bo_to_string[op])
 }
+
+func cmpBoolToBool(left bool, op binary_operator_t, right bool) (bool, error) {
+	switch op {
+	case bo_eq:
+		return left == right, nil
+	case bo_ne:
+		return left != right, nil
+	}
+
+	return false, fmt.Errorf("you cannot do such operation 'bool %s bool'", bo_to_string[op])
+}
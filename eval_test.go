@@ -1,7 +1,9 @@
 package quang
 
 import (
+	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -380,3 +382,1302 @@ func TestEvaluatingLazyAtomsNeOperator(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, true, result)
 }
+
+func TestEvaluatingNotExpressions(t *testing.T) {
+	tests := map[string]bool{
+		"not true":                        false,
+		"not false":                       true,
+		"not not true":                    true,
+		"not (true)":                      false,
+		"not (true or false)":             false,
+		"not (false or false)":            true,
+		"not true or true":                true,
+		"not true and true":               false,
+		"true and not false":              true,
+		"not 1 eq 1":                      false,
+		"not 1 eq 2":                      true,
+		"not (1 eq 1 and 2 eq 2)":         false,
+		"not (1 eq 1) or not (2 eq 2)":    false,
+		"not ('a' eq 'b') and not 1 gt 2": true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parseExpression()
+
+		assert.Nil(t, err)
+
+		e := createEvaluator(expr)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+}
+
+func TestEvaluatingNotWithLazySymbols(t *testing.T) {
+	test := "not (method eq :get or status gte 500)"
+
+	l := createLexer(test)
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+
+	expr, err := p.parseExpression()
+
+	assert.Nil(t, err)
+
+	e := createEvaluator(expr)
+
+	e.setAtomValue(":get", 0)
+	e.addAtomVar("method", 1)
+	e.addIntegerVar("status", 200)
+
+	result, err := e.eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	e.addIntegerVar("status", 503)
+
+	result, err = e.eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, result)
+
+	e.addAtomVar("method", 0)
+	e.addIntegerVar("status", 200)
+
+	result, err = e.eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, result)
+}
+
+func TestEvaluatingNilExpressions(t *testing.T) {
+	tests := map[string]bool{
+		"nil eq nil":      true,
+		"nil ne nil":      false,
+		"'' eq nil":       true,
+		"nil eq ''":       true,
+		"'a' eq nil":      false,
+		"'a' ne nil":      true,
+		"0 eq nil":        false,
+		"0 ne nil":        true,
+		"0. eq nil":       false,
+		"true eq nil":     false,
+		"name eq nil":     true,
+		"name ne nil":     false,
+		"nil eq name":     true,
+		"not name eq nil": false,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parseExpression()
+
+		assert.Nil(t, err)
+
+		e := createEvaluator(expr)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+}
+
+func TestEvaluatingLazySymbolsNil(t *testing.T) {
+	test := "name eq nil"
+
+	l := createLexer(test)
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+
+	expr, err := p.parseExpression()
+
+	assert.Nil(t, err)
+
+	e := createEvaluator(expr)
+
+	e.addStringVar("name", "")
+
+	result, err := e.eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	e.addStringVar("name", "john")
+
+	result, err = e.eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, result)
+
+	e.addIntegerVar("name", 0)
+
+	result, err = e.eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, result)
+
+	e.addNilVar("name")
+
+	result, err = e.eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	test = "name gt 10"
+
+	l = createLexer(test)
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+
+	expr, err = p.parseExpression()
+
+	assert.Nil(t, err)
+
+	e = createEvaluator(expr)
+
+	result, err = e.eval()
+
+	assert.NotNil(t, err)
+	assert.Equal(t, false, result)
+	assert.Equal(t, "error: the variable 'name' does not exist", err.Error())
+
+	e.addNilVar("name")
+
+	result, err = e.eval()
+
+	assert.NotNil(t, err)
+	assert.Equal(t, false, result)
+	assert.Equal(t, "error: you cannot do such operation 'nil gt integer'", err.Error())
+}
+
+func TestEvaluatingBoolComparisons(t *testing.T) {
+	tests := map[string]bool{
+		"true eq true":   true,
+		"true eq false":  false,
+		"false eq false": true,
+		"true ne false":  true,
+		"true ne true":   false,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parseExpression()
+
+		assert.Nil(t, err)
+
+		e := createEvaluator(expr)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+}
+
+func TestEvaluatingLazySymbolsBool(t *testing.T) {
+	tests := map[string]bool{
+		"alive eq true":              true,
+		"alive ne true":              false,
+		"alive eq false":             false,
+		"alive":                      true,
+		"not alive":                  false,
+		"alive and size gt 0":        true,
+		"size gt 0 and alive":        true,
+		"(alive) or size gt 10":      true,
+		"not alive or size gt 10":    false,
+		"alive and not (size eq 10)": true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parseExpression()
+
+		assert.Nil(t, err)
+
+		e := createEvaluator(expr)
+
+		e.addBoolVar("alive", true)
+		e.addIntegerVar("size", 1)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	l := createLexer("size and alive")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+
+	expr, err := p.parseExpression()
+
+	assert.Nil(t, err)
+
+	e := createEvaluator(expr)
+
+	e.addBoolVar("alive", true)
+	e.addIntegerVar("size", 1)
+
+	result, err := e.eval()
+
+	assert.NotNil(t, err)
+	assert.Equal(t, false, result)
+	assert.Equal(t, "error: the variable 'size' is integer, expected bool", err.Error())
+}
+
+func TestEvaluatingMixedNumericExpressions(t *testing.T) {
+	tests := map[string]bool{
+		"1 eq 1.":     true,
+		"1. eq 1":     true,
+		"1 ne 1.5":    true,
+		"10 gt 9.99":  true,
+		"9.99 gt 10":  false,
+		"10 lt 10.01": true,
+		"10.5 lt 10":  false,
+		"10 gte 10.":  true,
+		"10. gte 11":  false,
+		"10 lte 10.":  true,
+		"10.1 lte 10": false,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parseExpression()
+
+		assert.Nil(t, err)
+
+		e := createEvaluator(expr)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	l := createLexer("latency gt 10")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+
+	expr, err := p.parseExpression()
+
+	assert.Nil(t, err)
+
+	e := createEvaluator(expr)
+
+	e.addFloatVar("latency", 10.5)
+
+	result, err := e.eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+
+	e.addFloatVar("latency", 9.5)
+
+	result, err = e.eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, result)
+}
+
+func TestEvaluatingShortCircuit(t *testing.T) {
+	tests := map[string]bool{
+		"false and missing eq 1":          false,
+		"true or missing eq 1":            true,
+		"1 eq 2 and :missing eq :missing": false,
+		"1 eq 1 or 'a' gt 1":              true,
+		"x ne nil and x reg '^a'":         false,
+		"x eq nil or x gt 10":             true,
+		"(false and missing) or true":     true,
+		"not (true or missing eq 1)":      false,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parseExpression()
+
+		assert.Nil(t, err)
+
+		e := createEvaluator(expr)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"true and missing eq 1":   "error: the variable 'missing' does not exist",
+		"false or missing eq 1":   "error: the variable 'missing' does not exist",
+		"missing eq 1 and false":  "error: the variable 'missing' does not exist",
+		"true and :missing eq :a": "error: the atom ':missing' does not exist",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parseExpression()
+
+		assert.Nil(t, err)
+
+		e := createEvaluator(expr)
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestEvaluatingLazySymbolsInvalidRegex(t *testing.T) {
+	test := "agent reg pattern"
+
+	l := createLexer(test)
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+
+	expr, err := p.parseExpression()
+
+	assert.Nil(t, err)
+
+	e := createEvaluator(expr)
+
+	e.addStringVar("agent", "curl/7")
+	e.addStringVar("pattern", "(curl")
+
+	result, err := e.eval()
+
+	assert.NotNil(t, err)
+	assert.Equal(t, false, result)
+	assert.Equal(t, "error: invalid regex pattern '(curl': error parsing regexp: missing closing ): `(curl`", err.Error())
+
+	e.addStringVar("pattern", "^curl")
+
+	result, err = e.eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, result)
+}
+
+func TestEvaluatingInExpressions(t *testing.T) {
+	tests := map[string]bool{
+		"500 in [500, 502, 503]":                    true,
+		"501 in [500, 502, 503]":                    false,
+		"501 not in [500, 502, 503]":                true,
+		"502 not in [500, 502, 503]":                false,
+		"1 in []":                                   false,
+		"1 not in []":                               true,
+		"1.0 in [1, 2]":                             true,
+		"2 in [1.5, 2.0]":                           true,
+		"1.5 in [1.5, 2]":                           true,
+		"'a' in ['a', 'b']":                         true,
+		"'c' in ['a', 'b']":                         false,
+		"nil in [1]":                                false,
+		"not 1 in [1]":                              false,
+		"method in [:get, :head]":                   true,
+		"method in [:post]":                         false,
+		"method not in [:post]":                     true,
+		"status in [500, 503] or method in [:head]": false,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.setAtomValue(":get", 0)
+		e.setAtomValue(":head", 1)
+		e.setAtomValue(":post", 2)
+		e.addAtomVar("method", 0)
+		e.addIntegerVar("status", 200)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"'a' in [1, 2]":                   "error: you cannot do such operation 'string in integer list'",
+		"method in [1, 2]":                "error: you cannot do such operation 'atom in integer list'",
+		"1 not in [:get]":                 "error: you cannot do such operation 'integer not in atom list'",
+		"method in [:delete]":             "error: the atom ':delete' does not exist",
+		"method in [:get, :nope]":         "error: the atom ':nope' does not exist",
+		"method in [:nope, :get]":         "error: the atom ':nope' does not exist",
+		"[:get, :nope] contains method":   "error: the atom ':nope' does not exist",
+		"any([:get, :nope], _ eq method)": "error: the atom ':nope' does not exist",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.setAtomValue(":get", 0)
+		e.addAtomVar("method", 0)
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestEvaluatingRangeExpressions(t *testing.T) {
+	tests := map[string]bool{
+		"4 between 4 and 10":                   true,
+		"10 between 4 and 10":                  true,
+		"11 between 4 and 10":                  false,
+		"3 between 4 and 10":                   false,
+		"5 not between 4 and 10":               false,
+		"11 not between 4 and 10":              true,
+		"10 in 4..10":                          true,
+		"10 in 4..<10":                         false,
+		"9.99 in 4..<10":                       true,
+		"4.5 between 4 and 5":                  true,
+		"'b' between 'a' and 'c'":              true,
+		"'d' in 'a'..'c'":                      false,
+		"cors between low and 8 and true":      true,
+		"cors between 4 and 10 or cors eq 100": true,
+		"nil between 1 and 2":                  false,
+		"(cors between 1 and 2) or true":       true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addIntegerVar("cors", 8)
+		e.addIntegerVar("low", 4)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"'a' between 1 and 2":    "error: you cannot do such operation 'string in integer..integer'",
+		"cors not in 1..'z'":     "error: you cannot do such operation 'integer not in integer..string'",
+		"cors between nil and 2": "error: you cannot do such operation 'integer in nil..integer'",
+		"cors between x and 2":   "error: the variable 'x' does not exist",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addIntegerVar("cors", 8)
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestEvaluatingStringOperators(t *testing.T) {
+	tests := map[string]bool{
+		"'https://example.com/api?a=1' contains '/api?'":       true,
+		"'https://example.com/api' contains 'API'":             false,
+		"'https://example.com/api' startswith 'https://'":      true,
+		"'https://example.com/api' startswith 'http://'":       false,
+		"'https://example.com/api' endswith '.com/api'":        true,
+		"'https://example.com/api' endswith '.com'":            false,
+		"'Hello World' ieq 'hello world'":                      true,
+		"'Hello World' ieq 'hello'":                            false,
+		"'Mozilla (compatible; Googlebot)' icontains 'BOT'":    true,
+		"'Mozilla (compatible; Googlebot)' icontains 'spider'": false,
+		"'' contains ''": true,
+		"agent contains 'bot' and not agent startswith 'curl'": true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addStringVar("agent", "googlebot")
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"10 contains 'a'":     "error: you cannot do such operation 'integer contains string'",
+		"'a' startswith 1":    "error: you cannot do such operation 'string startswith integer'",
+		":get endswith 'a'":   "error: you cannot do such operation 'atom endswith string'",
+		"true ieq 'true'":     "error: you cannot do such operation 'bool ieq string'",
+		"agent icontains nil": "error: you cannot do such operation 'string icontains nil'",
+		"1.5 icontains 1.5":   "error: you cannot do such operation 'float icontains float'",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.setAtomValue(":get", 0)
+		e.addStringVar("agent", "googlebot")
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestEvaluatingLikeExpressions(t *testing.T) {
+	tests := map[string]bool{
+		"host like '*.internal'":            true,
+		"host like '*.com'":                 false,
+		"path like '/api/*/users'":          true,
+		"path like '/api/v?/users'":         true,
+		"path like '/api/v[2-9]/users'":     false,
+		"'a*b' like 'a\\\\*b'":              true,
+		"'axb' like 'a\\\\*b'":              false,
+		"host like pattern":                 true,
+		"not host like 'web-*' and ok":      true,
+		"host like '*.internal' or missing": true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addStringVar("host", "db.internal")
+		e.addStringVar("path", "/api/v1/users")
+		e.addStringVar("pattern", "db.*")
+		e.addBoolVar("ok", true)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"10 like '1*'":      "error: you cannot do such operation 'integer like string'",
+		":get like 'g*'":    "error: you cannot do such operation 'atom like string'",
+		"host like nil":     "error: you cannot do such operation 'string like nil'",
+		"host like invalid": "error: invalid glob pattern '[abc': missing closing ]",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.setAtomValue(":get", 0)
+		e.addStringVar("host", "db.internal")
+		e.addStringVar("invalid", "[abc")
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestEvaluatingArithmeticExpressions(t *testing.T) {
+	tests := map[string]bool{
+		"bytes_out - bytes_in gt 1024":         true,
+		"bytes_out - bytes_in gt 2048":         false,
+		"duration / 1000 gte 2.5":              true,
+		"duration / 1000 gte 3":                false,
+		"1 + 2 * 3 eq 7":                       true,
+		"(1 + 2) * 3 eq 9":                     true,
+		"10 - 4 - 3 eq 3":                      true,
+		"7 / 2 eq 3.5":                         true,
+		"7 % 3 eq 1":                           true,
+		"7.5 % 2 eq 1.5":                       true,
+		"ratio * 2 eq 1":                       true,
+		"bytes_in + 0.5 gt bytes_in":           true,
+		"status - status % 100 eq 500":         true,
+		"status + 1 in [504]":                  true,
+		"duration between 2000 + 500 and 3000": true,
+		"status + 1 eq nil":                    false,
+		"(status) eq 503":                      true,
+		"status gt (bytes_in - 500)":           true,
+		"bytes_out / (bytes_in * 2) eq 1.5":    true,
+		"2 * (bytes_out - bytes_in) eq 4000":   true,
+		"duration / (10 * (2 + 3)) eq 52.0":    true,
+		"-(bytes_in + 1) eq -1001":             true,
+		"status in (500 + 1)..(500 + 5)":       true,
+		"9223372036854775807 - 1 gt 0":         true,
+		"-9223372036854775807 - 1 lt 0":        true,
+		"-9223372036854775808 * 1 lt 0":        true,
+		"-3037000499 * 3037000499 lt 0":        true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addIntegerVar("bytes_out", 3000)
+		e.addIntegerVar("bytes_in", 1000)
+		e.addIntegerVar("duration", 2600)
+		e.addIntegerVar("status", 503)
+		e.addFloatVar("ratio", 0.5)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"status / 0 gt 1":                    "error: division by zero",
+		"status % zero gt 1":                 "error: division by zero",
+		"ratio / 0.0 gt 1":                   "error: division by zero",
+		"agent + 1 gt 1":                     "error: you cannot do such operation 'string + integer'",
+		"missing * 2 gt 1":                   "error: you cannot do such operation 'nil * integer'",
+		"unknown * 2 gt 1":                   "error: the variable 'unknown' does not exist",
+		"status + 1":                         "error: expected bool but got integer",
+		"ok or status / 2":                   "error: expected bool but got float",
+		"status + 9223372036854775807 gt 0":  "error: 503 + 9223372036854775807 overflows integer",
+		"-status - 9223372036854775807 lt 0": "error: -503 - 9223372036854775807 overflows integer",
+		"status * 4611686018427387904 gt 0":  "error: 503 * 4611686018427387904 overflows integer",
+		"-9223372036854775808 * -1 gt 0":     "error: -9223372036854775808 * -1 overflows integer",
+		"-(-9223372036854775808) gt 0":       "error: -(-9223372036854775808) overflows integer",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addIntegerVar("status", 503)
+		e.addIntegerVar("zero", 0)
+		e.addFloatVar("ratio", 0.5)
+		e.addStringVar("agent", "curl")
+		e.addNilVar("missing")
+		e.addBoolVar("ok", false)
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestEvaluatingNegativeAndNotationLiterals(t *testing.T) {
+	tests := map[string]bool{
+		"temperature lt -5":                true,
+		"temperature gt -5":                false,
+		"temperature eq -10":               true,
+		"ratio gt 1e-3":                    true,
+		"ratio gt 1E-1":                    false,
+		"1e3 eq 1000":                      true,
+		"1_000_000 eq 1000000":             true,
+		"0xff eq 255 and 0XFF_FF eq 65535": true,
+		"-0x10 eq -16":                     true,
+		"-temperature eq 10":               true,
+		"- temperature gt 5":               true,
+		"--temperature eq -10":             true,
+		"-ratio lt 0":                      true,
+		"temperature-1 eq -11":             true,
+		"2 - -3 eq 5":                      true,
+		"temperature in -20..-5":           true,
+		"temperature in [-10, -20]":        true,
+		"-9223372036854775808 lt 0":        true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addIntegerVar("temperature", -10)
+		e.addFloatVar("ratio", 0.01)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"-agent eq 1":   "error: you cannot do such operation '-string'",
+		"-missing eq 1": "error: you cannot do such operation '-nil'",
+		"-temperature":  "error: expected bool but got integer",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addIntegerVar("temperature", -10)
+		e.addStringVar("agent", "curl")
+		e.addNilVar("missing")
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestEvaluatingCalls(t *testing.T) {
+	tests := map[string]bool{
+		"len(name) gt 3":                        true,
+		"len(name) eq 5":                        true,
+		"len('ção') eq 3":                       true,
+		"len(empty) eq 0":                       true,
+		"lower(agent) contains 'bot'":           true,
+		"lower(agent) eq 'googlebot/2.1'":       true,
+		"lower(empty) eq nil":                   true,
+		"abs(delta) lt 5":                       true,
+		"abs(delta) eq 3":                       true,
+		"abs(-2.5) eq 2.5":                      true,
+		"abs(7) eq 7":                           true,
+		"coalesce(region, 'us') eq 'us'":        true,
+		"coalesce(empty, region, 'us') eq 'us'": true,
+		"coalesce(name, 'us') eq 'Alice'":       true,
+		"coalesce(region, nil) eq nil":          true,
+		"coalesce(latency, 0) eq 0.0":           true,
+		"coalesce(alive, false)":                true,
+		"not coalesce(region, false)":           true,
+		"len(lower(name)) + abs(delta) eq 8":    true,
+		"(len(name)) gt 3":                      true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addStringVar("name", "Alice")
+		e.addStringVar("agent", "Googlebot/2.1")
+		e.addStringVar("empty", "")
+		e.addIntegerVar("delta", -3)
+		e.addNilVar("latency")
+		e.addBoolVar("alive", true)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"len(size) gt 1":                 "error: you cannot call len(integer)",
+		"abs(name) gt 1":                 "error: you cannot call abs(string)",
+		"coalesce(name, size) eq 1":      "error: you cannot call coalesce(string, integer)",
+		"len(missing) gt 1":              "error: the variable 'missing' does not exist",
+		"abs(-9223372036854775808) gt 1": "error: the absolute value of -9223372036854775808 overflows integer",
+		"len(name)":                      "error: the function 'len' returned integer, expected bool",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addStringVar("name", "Alice")
+		e.addIntegerVar("size", 10)
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestEvaluatingQuotedSymbols(t *testing.T) {
+	tests := map[string]bool{
+		"`user agent` reg 'curl' and `content-type` eq 'json'": true,
+		"`p 99` gt 1.5 and http2":                              true,
+		"`geo.country` eq 'br'":                                true,
+		"len(`user agent`) eq 8":                               true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addStringVar("user agent", "curl/8.0")
+		e.addStringVar("content-type", "json")
+		e.addFloatVar("p 99", 2.5)
+		e.addBoolVar("http2", true)
+		e.addStringVar("geo.country", "br")
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	// quoted names are never function calls
+	l := createLexer("`len`(name) eq 2")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+
+	expr, err := p.parse()
+
+	assert.Nil(t, expr)
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: expected comparison operator after expression but got \"(\"", err.Error())
+}
+
+func TestEvaluatingLists(t *testing.T) {
+	tests := map[string]bool{
+		"tags contains 'prod'":                           true,
+		"tags contains 'dev'":                            false,
+		"not tags contains 'dev'":                        true,
+		"ports contains 443":                             true,
+		"ports contains 443.0":                           true,
+		"latencies contains 0.5":                         true,
+		"roles contains :admin":                          true,
+		"roles contains :guest":                          false,
+		"empty contains 'prod'":                          false,
+		"len(tags) eq 3":                                 true,
+		"len(empty) eq 0":                                true,
+		"empty eq nil":                                   true,
+		"tags ne nil":                                    true,
+		"any(tags, _ reg '^team-')":                      true,
+		"any(tags, _ startswith 'dev')":                  false,
+		"all(tags, len(_) gt 3)":                         true,
+		"all(ports, _ gt 50 and _ lt 1000)":              true,
+		"all(ports, _ eq 443)":                           false,
+		"any(latencies, _ * 1000 gt 900)":                true,
+		"any(roles, _ eq :admin)":                        true,
+		"any(empty, _ eq 'prod')":                        false,
+		"all(empty, _ eq 'prod')":                        true,
+		"any(missing, _ eq 'prod')":                      false,
+		"all([1, 2, 3], _ gt 0)":                         true,
+		"any(tags, any(ports, _ eq 80) and _ eq 'prod')": true,
+		"any(tags, _ eq 'prod') and len(tags) gt 1":      true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addStringListVar("tags", []string{"prod", "team-api", "backend"})
+		e.addIntegerListVar("ports", []IntegerType{80, 443})
+		e.addFloatListVar("latencies", []FloatType{0.5, 1.2})
+		e.addAtomListVar("roles", []AtomType{0})
+		e.addStringListVar("empty", []string{})
+		e.addNilVar("missing")
+		e.setAtomValue(":admin", 0)
+		e.setAtomValue(":guest", 1)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"tags contains 1":          "error: you cannot do such operation 'string list contains integer'",
+		"tags eq 'prod'":           "error: you cannot do such operation 'list eq string'",
+		"any(name, _ eq 'a')":      "error: you cannot call any(string, bool)",
+		"any(tags, _ gt 1)":        "error: you cannot do such operation 'string gt integer'",
+		"any(tags, _)":             "error: the variable '_' is string, expected bool",
+		"_ eq 'prod'":              "error: the variable '_' does not exist",
+		"any(tags, _ eq 'a') or _": "error: the variable '_' does not exist",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addStringListVar("tags", []string{"prod", "team-api"})
+		e.addStringVar("name", "Alice")
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestEvaluatingTimesAndDurations(t *testing.T) {
+	clock := func() time.Time {
+		return time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	}
+
+	tests := map[string]bool{
+		"ts gt 2024-05-01T00:00:00Z":                            true,
+		"ts eq 2024-05-01T12:00:00Z":                            true,
+		"ts eq 2024-05-01T09:00:00-03:00":                       true,
+		"ts lt 2024-05-01T11:59:59.999Z":                        false,
+		"ts between 2024-05-01T00:00:00Z and now()":             true,
+		"ts in 2024-05-01T00:00:00Z..<2024-05-02T00:00:00Z":     true,
+		"ts in 2024-05-01T00:00:00-03:00..2024-05-02T00:00:00Z": true,
+		"ts in 2024-05-01T10:00:00-03:00..2024-05-02T00:00:00Z": false,
+		"elapsed gte 250ms":                                     true,
+		"elapsed lt 0.5s":                                       true,
+		"elapsed eq 300_000us":                                  true,
+		"elapsed in 100ms..1s":                                  true,
+		"ts gt now() - 1h":                                      true,
+		"ts gt now() - 15m":                                     false,
+		"now() - ts eq 30m":                                     true,
+		"ts + 30m eq now()":                                     true,
+		"1h + ts gt now()":                                      true,
+		"elapsed * 2 eq 600ms":                                  true,
+		"2 * elapsed eq 600ms":                                  true,
+		"elapsed * 1.5 eq 450ms":                                true,
+		"elapsed / 3 eq 100ms":                                  true,
+		"1h / 30m eq 2.0":                                       true,
+		"1h30m - 90m eq 0s":                                     true,
+		"-elapsed lt 0s":                                        true,
+		"abs(-elapsed) eq elapsed":                              true,
+		"(now() - ts) / 1m gt 29":                               true,
+		"missing eq nil":                                        true,
+		"coalesce(missing, 1s) eq 1000ms":                       true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+		e.clock = clock
+
+		e.addTimeVar("ts", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+		e.addDurationVar("elapsed", 300*time.Millisecond)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"ts gt 1":              "error: you cannot do such operation 'time gt integer'",
+		"elapsed gt 250":       "error: you cannot do such operation 'duration gt integer'",
+		"ts + ts gt now()":     "error: you cannot do such operation 'time + time'",
+		"ts * 2 gt now()":      "error: you cannot do such operation 'time * integer'",
+		"elapsed + 1 gt 1s":    "error: you cannot do such operation 'duration + integer'",
+		"2 / elapsed gt 1s":    "error: you cannot do such operation 'integer / duration'",
+		"elapsed / 0 gt 1s":    "error: division by zero",
+		"elapsed / 0s gt 1.0":  "error: division by zero",
+		"elapsed * 1e30 gt 1s": "error: the duration 300ms * 1e+30 overflows",
+		"ts":                   "error: the variable 'ts' is time, expected bool",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+		e.clock = clock
+
+		e.addTimeVar("ts", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+		e.addDurationVar("elapsed", 300*time.Millisecond)
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+		assert.Equal(t, false, result)
+	}
+}
+
+func TestEvaluatingAddresses(t *testing.T) {
+	tests := map[string]bool{
+		"dst_ip eq 192.168.1.1":                     true,
+		"dst_ip ne 192.168.1.2":                     true,
+		"src_ip in 10.0.0.0/8":                      true,
+		"src_ip in 10.2.0.0/16":                     false,
+		"src_ip not in 192.168.0.0/16":              true,
+		"src_ip in 10.0.0.1..10.0.0.9":              false,
+		"src_ip in 10.0.0.0..10.255.255.255":        true,
+		"src_ip gt 9.255.255.255":                   true,
+		"v6 in 2001:db8::/32":                       true,
+		"v6 eq 2001:0db8::0001":                     true,
+		"v6 in 10.0.0.0/8":                          false,
+		"src_ip in ::ffff:10.0.0.0/104":             false,
+		"mapped eq 10.20.30.40":                     true,
+		"mapped in 10.0.0.0/8":                      true,
+		"mapped eq ::ffff:10.20.30.40":              true,
+		"loopback eq ::1":                           true,
+		"missing in 10.0.0.0/8":                     false,
+		"missing not in 10.0.0.0/8":                 true,
+		"invalid eq nil":                            true,
+		"coalesce(invalid, 127.0.0.1) eq 127.0.0.1": true,
+		"src_ip in 10.0.0.0/8 and method eq :add":   true,
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addIPVar("dst_ip", netip.MustParseAddr("192.168.1.1"))
+		e.addIPVar("src_ip", netip.MustParseAddr("10.1.2.3"))
+		e.addIPVar("v6", netip.MustParseAddr("2001:db8::1"))
+		e.addIPVar("mapped", netip.MustParseAddr("::ffff:10.20.30.40"))
+		e.addIPVar("loopback", netip.IPv6Loopback())
+		e.addIPVar("invalid", netip.Addr{})
+		e.addNilVar("missing")
+		e.addAtomVar("method", 0)
+		e.setAtomValue(":add", 0)
+
+		result, err := e.eval()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, expected, result, "test: %s", test)
+	}
+
+	fail_tests := map[string]string{
+		"name in 10.0.0.0/8":     "error: you cannot do such operation 'string in prefix'",
+		"src_ip eq '10.1.2.3'":   "error: you cannot do such operation 'ip eq string'",
+		"src_ip + 1 eq 10.1.2.4": "error: you cannot do such operation 'ip + integer'",
+		"src_ip":                 "error: the variable 'src_ip' is ip, expected bool",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex(), "test: %s", test)
+
+		p := createParser(l.tokens)
+
+		expr, err := p.parse()
+
+		assert.Nil(t, err, "test: %s", test)
+
+		e := createEvaluator(expr)
+
+		e.addIPVar("src_ip", netip.MustParseAddr("10.1.2.3"))
+		e.addStringVar("name", "Alice")
+
+		result, err := e.eval()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+		assert.Equal(t, false, result)
+	}
+}
@@ -0,0 +1,209 @@
+package quang
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+type function_t struct {
+	name string
+
+	// number of arguments accepted, `maxArgs` is -1 for variadic functions
+	minArgs, maxArgs int
+
+	// when true, variables that were never provided are passed as nil instead of failing
+	nilable bool
+
+	// when true, the last argument is a condition checked for each item of the list,
+	// `every` tells if all of them must match or just one
+	predicate, every bool
+
+	// kind of the result for the kinds of the arguments, false when the function cannot take them
+	kind func(args []expression_kind_t) (expression_kind_t, bool)
+
+	// `expr` is the call being evaluated, used to report errors
+	call func(e *evaluator_t, expr *expression_t, args []*expression_t) (*expression_t, error)
+}
+
+type call_expression_t struct {
+	function *function_t
+	args     []*expression_t
+}
+
+// All the functions are pure, the result only depends on the arguments,
+// except for `now`, which reads the clock of the evaluator
+var functions = map[string]*function_t{
+	"len": {
+		name:    "len",
+		minArgs: 1,
+		maxArgs: 1,
+		kind: func(args []expression_kind_t) (expression_kind_t, bool) {
+			return ek_integer, args[0] == ek_string || args[0] == ek_list || args[0] == ek_nil
+		},
+		call: func(e *evaluator_t, expr *expression_t, args []*expression_t) (*expression_t, error) {
+			if args[0].kind == ek_list {
+				return &expression_t{kind: ek_integer, integer: IntegerType(len(args[0].list.items))}, nil
+			}
+
+			return &expression_t{kind: ek_integer, integer: IntegerType(utf8.RuneCountInString(args[0].string))}, nil
+		},
+	},
+	"lower": {
+		name:    "lower",
+		minArgs: 1,
+		maxArgs: 1,
+		kind: func(args []expression_kind_t) (expression_kind_t, bool) {
+			return args[0], args[0] == ek_string || args[0] == ek_nil
+		},
+		call: func(e *evaluator_t, expr *expression_t, args []*expression_t) (*expression_t, error) {
+			if args[0].kind == ek_nil {
+				return args[0], nil
+			}
+
+			return &expression_t{kind: ek_string, string: strings.ToLower(args[0].string)}, nil
+		},
+	},
+	"abs": {
+		name:    "abs",
+		minArgs: 1,
+		maxArgs: 1,
+		kind: func(args []expression_kind_t) (expression_kind_t, bool) {
+			return args[0], isNumberKind(args[0]) || args[0] == ek_duration || args[0] == ek_nil
+		},
+		call: func(e *evaluator_t, expr *expression_t, args []*expression_t) (*expression_t, error) {
+			value := args[0]
+
+			switch value.kind {
+			case ek_integer:
+				if value.integer == math.MinInt64 {
+					return nil, arithmeticError(expr, "error: the absolute value of %d overflows integer", value.integer)
+				}
+
+				if value.integer < 0 {
+					return &expression_t{kind: ek_integer, integer: -value.integer}, nil
+				}
+			case ek_float:
+				return &expression_t{kind: ek_float, float: FloatType(math.Abs(float64(value.float)))}, nil
+			case ek_duration:
+				if value.duration == math.MinInt64 {
+					return nil, arithmeticError(expr, "error: the absolute value of %s overflows duration", value.duration)
+				}
+
+				return &expression_t{kind: ek_duration, duration: value.duration.Abs()}, nil
+			}
+
+			return value, nil
+		},
+	},
+	"coalesce": {
+		name:    "coalesce",
+		minArgs: 1,
+		maxArgs: -1,
+		nilable: true,
+		kind: func(args []expression_kind_t) (expression_kind_t, bool) {
+			result := ek_nil
+
+			for _, kind := range args {
+				switch {
+				case kind == ek_nil:
+				case result == ek_nil:
+					result = kind
+				case isNumberKind(result) && isNumberKind(kind):
+					if kind == ek_float {
+						result = ek_float
+					}
+				case result != kind:
+					return ek_nil, false
+				}
+			}
+
+			return result, result != ek_list
+		},
+		call: func(e *evaluator_t, expr *expression_t, args []*expression_t) (*expression_t, error) {
+			promote := false
+
+			for _, arg := range args {
+				promote = promote || arg.kind == ek_float
+			}
+
+			for _, arg := range args {
+				if isEmptyValue(arg) {
+					continue
+				}
+
+				// `coalesce(latency, 0)` is always a float when `latency` is
+				if promote && arg.kind == ek_integer {
+					return &expression_t{kind: ek_float, float: toFloat(arg)}, nil
+				}
+
+				return arg, nil
+			}
+
+			return &expression_t{kind: ek_nil}, nil
+		},
+	},
+	"now": {
+		name:    "now",
+		minArgs: 0,
+		maxArgs: 0,
+		kind: func(args []expression_kind_t) (expression_kind_t, bool) {
+			return ek_time, true
+		},
+		call: func(e *evaluator_t, expr *expression_t, args []*expression_t) (*expression_t, error) {
+			return &expression_t{kind: ek_time, time: e.now()}, nil
+		},
+	},
+	"any": {
+		name:      "any",
+		minArgs:   2,
+		maxArgs:   2,
+		predicate: true,
+		kind:      quantifierKind,
+	},
+	"all": {
+		name:      "all",
+		minArgs:   2,
+		maxArgs:   2,
+		predicate: true,
+		every:     true,
+		kind:      quantifierKind,
+	},
+}
+
+// Quantifiers are evaluated by the evaluator, since the condition is evaluated for each item
+func quantifierKind(args []expression_kind_t) (expression_kind_t, bool) {
+	return ek_bool, (args[0] == ek_list || args[0] == ek_nil) && args[1] == ek_bool
+}
+
+// Human readable form of a call, like `len(string)`, used to report errors
+func callSignature(function *function_t, args []expression_kind_t) string {
+	names := make([]string, 0, len(args))
+
+	for _, kind := range args {
+		names = append(names, ek_to_string[kind])
+	}
+
+	return function.name + "(" + strings.Join(names, ", ") + ")"
+}
+
+func describeArity(function *function_t) string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+
+		return fmt.Sprintf("%d arguments", n)
+	}
+
+	if function.maxArgs < 0 {
+		return "at least " + plural(function.minArgs)
+	}
+
+	if function.minArgs == function.maxArgs {
+		return plural(function.minArgs)
+	}
+
+	return fmt.Sprintf("%d to %d arguments", function.minArgs, function.maxArgs)
+}
@@ -0,0 +1,94 @@
+package quang
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Translates a glob pattern into an anchored regex.
+// `*` matches any sequence of characters, `?` any single character,
+// `[abc]` or `[a-z]` one of the characters and `[!abc]` or `[^abc]` any other one.
+// `\` escapes the next character, so `\*` matches a literal `*`.
+func globToRegex(glob string) (string, error) {
+	var out strings.Builder
+
+	out.WriteString("(?s)^")
+
+	runes := []rune(glob)
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		switch c {
+		case '*':
+			out.WriteString(".*")
+		case '?':
+			out.WriteString(".")
+		case '\\':
+			if i+1 >= len(runes) {
+				return "", fmt.Errorf("trailing escape character")
+			}
+
+			i++
+
+			out.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '[':
+			end := i + 1
+
+			if end < len(runes) && (runes[end] == '!' || runes[end] == '^') {
+				end++
+			}
+
+			// a `]` right after the opening is part of the class
+			if end < len(runes) && runes[end] == ']' {
+				end++
+			}
+
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+
+			if end >= len(runes) {
+				return "", fmt.Errorf("missing closing ]")
+			}
+
+			class := runes[i+1 : end]
+
+			out.WriteString("[")
+
+			if class[0] == '!' || class[0] == '^' {
+				out.WriteString("^")
+				class = class[1:]
+			}
+
+			for _, r := range class {
+				if r == '\\' || r == '[' || r == ']' {
+					out.WriteRune('\\')
+				}
+
+				out.WriteRune(r)
+			}
+
+			out.WriteString("]")
+
+			i = end
+		default:
+			out.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	out.WriteString("$")
+
+	return out.String(), nil
+}
+
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	pattern, err := globToRegex(glob)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return regexp.Compile(pattern)
+}
@@ -0,0 +1,58 @@
+package quang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchingGlobs(t *testing.T) {
+	type test_case_t struct {
+		glob, value string
+		expected    bool
+	}
+
+	tests := []test_case_t{
+		{glob: "*.internal", value: "db.internal", expected: true},
+		{glob: "*.internal", value: "db.internal.com", expected: false},
+		{glob: "/api/*/users", value: "/api/v1/users", expected: true},
+		{glob: "/api/*/users", value: "/api/v1/admin/users", expected: true},
+		{glob: "*", value: "", expected: true},
+		{glob: "v?", value: "v1", expected: true},
+		{glob: "v?", value: "v10", expected: false},
+		{glob: "v?", value: "vé", expected: true},
+		{glob: "[abc]at", value: "bat", expected: true},
+		{glob: "[abc]at", value: "rat", expected: false},
+		{glob: "v[0-9]", value: "v7", expected: true},
+		{glob: "[!abc]at", value: "rat", expected: true},
+		{glob: "[^abc]at", value: "bat", expected: false},
+		{glob: "[]]", value: "]", expected: true},
+		{glob: "a.c", value: "abc", expected: false},
+		{glob: "a+(b)", value: "a+(b)", expected: true},
+		{glob: `\*`, value: "*", expected: true},
+		{glob: `\*`, value: "a", expected: false},
+		{glob: `a\?`, value: "a?", expected: true},
+		{glob: "line*", value: "line\nbreak", expected: true},
+	}
+
+	for _, test := range tests {
+		glob, err := compileGlob(test.glob)
+
+		assert.Nil(t, err, "glob: %s", test.glob)
+		assert.Equal(t, test.expected, glob.MatchString(test.value), "glob: %s, value: %s", test.glob, test.value)
+	}
+
+	fail_tests := map[string]string{
+		"[abc":  "missing closing ]",
+		"[!":    "missing closing ]",
+		`abc\`:  "trailing escape character",
+		"[z-a]": "error parsing regexp: invalid character class range: `z-a`",
+	}
+
+	for test, expected := range fail_tests {
+		_, err := compileGlob(test)
+
+		assert.NotNil(t, err, "glob: %s", test)
+		assert.Equal(t, expected, err.Error())
+	}
+}
@@ -0,0 +1,27 @@
+package quang
+
+import "net/netip"
+
+// `ip in 10.0.0.0/8` is true when the address belongs to the network of the prefix.
+// IPv4 addresses never belong to IPv6 networks and vice versa
+func prefixContains(expr *expression_t, left *expression_t, right *expression_t) (bool, error) {
+	if left.kind == ek_nil {
+		return false, nil
+	}
+
+	if left.kind != ek_ip {
+		return false, typeError(expr, "error: you cannot do such operation '%s %s prefix'", ek_to_string[left.kind], bo_to_string[expr.binary.operator])
+	}
+
+	return right.prefix.Contains(left.ip), nil
+}
+
+// Addresses are ordered by their bytes, and IPv4 addresses come before IPv6 ones,
+// so ranges like `ip in 10.0.0.1..10.0.0.9` work as expected
+func cmpIPToIP(left netip.Addr, op binary_operator_t, right netip.Addr) (bool, error) {
+	return cmpIntegerToInteger(IntegerType(left.Compare(right)), op, 0)
+}
+
+func cmpPrefixToPrefix(left netip.Prefix, op binary_operator_t, right netip.Prefix) (bool, error) {
+	return cmpBoolToBool(left == right, op, true)
+}
@@ -1,12 +1,20 @@
 package quang
 
-import "fmt"
+import (
+	"net/netip"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 type token_kind_t int
 
 type token_t struct {
 	value string
 	kind  token_kind_t
+
+	// byte offsets of the token in the query, `end` is exclusive
+	start, end int
 }
 
 type lexer_t struct {
@@ -18,6 +26,16 @@ type lexer_t struct {
 const (
 	tk_open_paren token_kind_t = iota
 	tk_close_paren
+	tk_open_bracket
+	tk_close_bracket
+	tk_comma
+	tk_range
+	tk_range_exclusive
+	tk_plus
+	tk_minus
+	tk_star
+	tk_slash
+	tk_percent
 	tk_and_keyword
 	tk_or_keyword
 	tk_nil_keyword
@@ -28,31 +46,54 @@ const (
 	tk_gte_keyword
 	tk_lte_keyword
 	tk_reg_keyword
+	tk_contains_keyword
+	tk_startswith_keyword
+	tk_endswith_keyword
+	tk_ieq_keyword
+	tk_icontains_keyword
+	tk_like_keyword
 
 	tk_symbol
+	tk_quoted_symbol
 
 	tk_integer
 	tk_atom
 	tk_string
 	tk_float
+	tk_time
+	tk_duration
+	tk_ip
+	tk_prefix
 
 	tk_true_keyword
 	tk_false_keyword
+	tk_not_keyword
+	tk_in_keyword
+	tk_between_keyword
 )
 
 var keywords = map[string]token_kind_t{
-	"true":  tk_true_keyword,
-	"false": tk_false_keyword,
-	"nil":   tk_nil_keyword,
-	"and":   tk_and_keyword,
-	"or":    tk_or_keyword,
-	"reg":   tk_reg_keyword,
-	"eq":    tk_eq_keyword,
-	"ne":    tk_ne_keyword,
-	"gt":    tk_gt_keyword,
-	"lt":    tk_lt_keyword,
-	"gte":   tk_gte_keyword,
-	"lte":   tk_lte_keyword,
+	"true":       tk_true_keyword,
+	"false":      tk_false_keyword,
+	"nil":        tk_nil_keyword,
+	"and":        tk_and_keyword,
+	"or":         tk_or_keyword,
+	"not":        tk_not_keyword,
+	"in":         tk_in_keyword,
+	"between":    tk_between_keyword,
+	"reg":        tk_reg_keyword,
+	"eq":         tk_eq_keyword,
+	"ne":         tk_ne_keyword,
+	"gt":         tk_gt_keyword,
+	"lt":         tk_lt_keyword,
+	"gte":        tk_gte_keyword,
+	"lte":        tk_lte_keyword,
+	"contains":   tk_contains_keyword,
+	"startswith": tk_startswith_keyword,
+	"endswith":   tk_endswith_keyword,
+	"ieq":        tk_ieq_keyword,
+	"icontains":  tk_icontains_keyword,
+	"like":       tk_like_keyword,
 }
 
 func createLexer(content string) lexer_t {
@@ -89,7 +130,7 @@ func (l *lexer_t) forward() {
 }
 
 func (l *lexer_t) trimWhitespaces() {
-	for !l.isEmpty() && l.content[l.cursor] == ' ' {
+	for !l.isEmpty() && isWhitespace(l.content[l.cursor]) {
 		l.forward()
 	}
 }
@@ -100,48 +141,344 @@ func (l *lexer_t) lexSingleChar(kind token_kind_t) {
 	token := token_t{
 		value: l.content[l.bot:l.cursor],
 		kind:  kind,
+		start: l.bot,
+		end:   l.cursor,
 	}
 
 	l.tokens = append(l.tokens, token)
 }
 
-func (l *lexer_t) lexNumber() {
-	for !l.isEmpty() && isDigit(l.char()) {
+func (l *lexer_t) lexRange() error {
+	if l.isEmptyAhead() || l.charAhead() != '.' {
+		return syntaxError(l.cursor, l.cursor+1, "error: unexpected character \".\" at position %d", l.cursor+1)
+	}
+
+	l.forward()
+
+	if !l.isEmptyAhead() && l.charAhead() == '<' {
 		l.forward()
+		l.lexSingleChar(tk_range_exclusive)
+	} else {
+		l.lexSingleChar(tk_range)
 	}
 
-	isFloat := false
+	return nil
+}
 
-	if l.char() == '.' {
-		isFloat = true
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
 
+// Digits can be separated by underscores, like in `1_000_000`
+func (l *lexer_t) lexDigits(isValidDigit func(byte) bool) {
+	for !l.isEmpty() && (isValidDigit(l.char()) || l.char() == '_') {
 		l.forward()
+	}
+}
+
+// A `-` is the sign of a number, and not a subtraction, when it does not follow a value,
+// like in `temperature lt -5` or `[-1, -2]`
+func (l lexer_t) isSignPosition() bool {
+	if l.isEmptyAhead() || !isDigit(l.charAhead()) {
+		return false
+	}
+
+	if len(l.tokens) == 0 {
+		return true
+	}
+
+	switch l.tokens[len(l.tokens)-1].kind {
+	case tk_integer, tk_float, tk_time, tk_duration, tk_ip, tk_prefix, tk_symbol, tk_quoted_symbol, tk_string, tk_atom, tk_close_paren, tk_close_bracket,
+		tk_true_keyword, tk_false_keyword, tk_nil_keyword:
+		return false
+	}
+
+	return true
+}
+
+// Underscores are only allowed between two digits
+func hasValidUnderscores(number string, isValidDigit func(byte) bool) bool {
+	for i := 0; i < len(number); i++ {
+		if number[i] != '_' {
+			continue
+		}
+
+		if i == 0 || i+1 == len(number) || !isValidDigit(number[i-1]) || !isValidDigit(number[i+1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (l *lexer_t) lexNumber() error {
+	if l.char() == '-' {
+		l.forward()
+	}
+
+	isFloat := false
+	isValidDigit := isDigit[byte]
+
+	if l.char() == '0' && !l.isEmptyAhead() && (l.charAhead() == 'x' || l.charAhead() == 'X') {
+		l.forward()
+		l.forward()
+
+		digits := l.cursor
+		isValidDigit = isHexDigit
+
+		l.lexDigits(isValidDigit)
+
+		if l.cursor == digits {
+			return syntaxError(l.bot, l.cursor, "error: missing hexadecimal digits at position %d", l.bot+1)
+		}
+	} else {
+		l.lexDigits(isDigit[byte])
+
+		// `1..5` is a range, not the float `1.`
+		if l.char() == '.' && (l.isEmptyAhead() || l.charAhead() != '.') {
+			isFloat = true
 
-		for !l.isEmpty() && isDigit(l.char()) {
 			l.forward()
+
+			l.lexDigits(isDigit[byte])
+		}
+
+		if l.char() == 'e' || l.char() == 'E' {
+			exponent := l.cursor + 1
+
+			if exponent < len(l.content) && (l.content[exponent] == '+' || l.content[exponent] == '-') {
+				exponent++
+			}
+
+			if exponent < len(l.content) && isDigit(l.content[exponent]) {
+				isFloat = true
+
+				l.cursor = exponent
+
+				l.lexDigits(isDigit[byte])
+			}
+		}
+
+		// a unit right after the number makes it a duration, like `250ms` or `1h30m`
+		if isSymbol(l.char()) && l.lexDuration() {
+			return nil
 		}
 	}
 
 	token := token_t{
 		kind:  tk_integer,
 		value: l.content[l.bot:l.cursor],
+		start: l.bot,
+		end:   l.cursor,
 	}
 
 	if isFloat {
 		token.kind = tk_float
 	}
 
+	if !hasValidUnderscores(token.value, isValidDigit) {
+		return syntaxError(token.start, token.end, "error: invalid number \"%s\" at position %d, underscores must be between digits", token.value, token.start+1)
+	}
+
+	if isFloat {
+		if _, err := parseFloat(token.value); err != nil {
+			return syntaxError(token.start, token.end, "error: the float \"%s\" at position %d is out of range", token.value, token.start+1)
+		}
+	} else if _, err := parseInteger(token.value); err != nil {
+		return syntaxError(token.start, token.end, "error: the integer \"%s\" at position %d is out of range", token.value, token.start+1)
+	}
+
 	l.tokens = append(l.tokens, token)
+
+	return nil
 }
 
+// Durations are written just like in Go, like `1.5s` or `1h30m`.
+// The units are `ns`, `us`, `ms`, `s`, `m` and `h`. When the letters after
+// the number are not a unit, nothing is consumed and the number is lexed as usual
+func (l *lexer_t) lexDuration() bool {
+	end := l.cursor
+
+	// `1s..5s` is a range, only a dot followed by a digit is part of the duration, like in `1h2.5m`
+	for end < len(l.content) && (isSymbolPart(l.content[end]) || (l.content[end] == '.' && end+1 < len(l.content) && isDigit(l.content[end+1]))) {
+		end++
+	}
+
+	value := l.content[l.bot:end]
+
+	if !hasValidUnderscores(value, isDigit[byte]) {
+		return false
+	}
+
+	if _, err := parseDuration(value); err != nil {
+		return false
+	}
+
+	l.cursor = end
+
+	l.tokens = append(l.tokens, token_t{
+		kind:  tk_duration,
+		value: value,
+		start: l.bot,
+		end:   l.cursor,
+	})
+
+	return true
+}
+
+// Times are RFC3339 timestamps, like `2024-05-01T00:00:00Z`,
+// they start with a full date followed by `T`
+func (l lexer_t) isTimeStart() bool {
+	const date = "0000-00-00T"
+
+	if l.cursor+len(date) > len(l.content) {
+		return false
+	}
+
+	for i := 0; i < len(date); i++ {
+		c := l.content[l.cursor+i]
+
+		if date[i] == '0' && !isDigit(c) || date[i] != '0' && c != date[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The parts are lexed in order, the date, the clock, the fraction and the offset,
+// so `-` and `.` are only taken where they belong, and in
+// `2024-05-01T00:00:00-03:00..2024-05-02T00:00:00Z` the `..` is still a range
+func (l *lexer_t) lexTime() error {
+	// the date and the `T` were already checked by `isTimeStart`
+	l.cursor += len("0000-00-00T")
+
+	l.lexClock()
+
+	// `.` is only the fraction when followed by a digit, like `00:00:00.5Z`
+	if l.char() == '.' && !l.isEmptyAhead() && isDigit(l.charAhead()) {
+		l.forward()
+
+		l.lexDigits(isDigit[byte])
+	}
+
+	// the offset is `Z` or a signed `hh:mm`
+	if l.char() == 'Z' {
+		l.forward()
+	} else if l.char() == '+' || l.char() == '-' {
+		l.forward()
+
+		l.lexClock()
+	}
+
+	token := token_t{
+		kind:  tk_time,
+		value: l.content[l.bot:l.cursor],
+		start: l.bot,
+		end:   l.cursor,
+	}
+
+	if _, err := time.Parse(time.RFC3339, token.value); err != nil {
+		return syntaxError(token.start, token.end, "error: invalid time \"%s\" at position %d, expected a RFC3339 time like 2024-05-01T00:00:00Z", token.value, token.start+1)
+	}
+
+	l.tokens = append(l.tokens, token)
+
+	return nil
+}
+
+// Digits separated by colons, like `00:00:00` or the `03:00` of an offset
+func (l *lexer_t) lexClock() {
+	for !l.isEmpty() && (isDigit(l.char()) || l.char() == ':') {
+		l.forward()
+	}
+}
+
+// End of the run of hex digits, colons and dots starting at the cursor.
+// `10.0.0.1..10.0.0.9` is a range, only a dot followed by a digit is part of the address
+func (l lexer_t) addressEnd() int {
+	end := l.cursor
+
+	for end < len(l.content) {
+		c := l.content[end]
+
+		if !isHexDigit(c) && c != ':' && (c != '.' || end+1 >= len(l.content) || !isHexDigit(l.content[end+1])) {
+			break
+		}
+
+		end++
+	}
+
+	return end
+}
+
+// IPv4 addresses are four numbers separated by dots, like `192.168.1.1`, and
+// IPv6 addresses have at least two colons, like `2001:db8::1` or `::1`.
+// IPv6 addresses can also start with a letter, like `fe80::1`, or with colons,
+// which otherwise start an atom, so only runs that look like addresses are taken
+func (l lexer_t) isAddressStart() bool {
+	value := l.content[l.cursor:l.addressEnd()]
+
+	if strings.Count(value, ":") >= 2 {
+		return true
+	}
+
+	// dotted paths like `a.b.c.d` are not addresses
+	return isDigit(value[0]) && strings.Count(value, ".") == 3
+}
+
+// Addresses followed by `/` and the prefix length are prefixes, like `10.0.0.0/8`
+func (l *lexer_t) lexAddress() error {
+	l.cursor = l.addressEnd()
+
+	kind := tk_ip
+
+	if l.char() == '/' && !l.isEmptyAhead() && isDigit(l.charAhead()) {
+		kind = tk_prefix
+
+		l.forward()
+
+		for !l.isEmpty() && isDigit(l.char()) {
+			l.forward()
+		}
+	}
+
+	token := token_t{
+		kind:  kind,
+		value: l.content[l.bot:l.cursor],
+		start: l.bot,
+		end:   l.cursor,
+	}
+
+	if kind == tk_ip {
+		if _, err := netip.ParseAddr(token.value); err != nil {
+			return syntaxError(token.start, token.end, "error: invalid IP address \"%s\" at position %d", token.value, token.start+1)
+		}
+	} else if _, err := netip.ParsePrefix(token.value); err != nil {
+		return syntaxError(token.start, token.end, "error: invalid IP prefix \"%s\" at position %d", token.value, token.start+1)
+	}
+
+	l.tokens = append(l.tokens, token)
+
+	return nil
+}
+
+// Symbols can be dotted paths to nested fields, like `request.headers.user_agent`
 func (l *lexer_t) lexSymbolOrKeyword() {
-	for !l.isEmpty() && isSymbol(l.char()) {
+	for !l.isEmpty() && isSymbolPart(l.char()) {
 		l.forward()
+
+		// `a..b` is a range, only a dot followed by a name continues the path
+		if l.char() == '.' && !l.isEmptyAhead() && isSymbol(l.charAhead()) {
+			l.forward()
+		}
 	}
 
 	token := token_t{
 		kind:  tk_symbol,
 		value: l.content[l.bot:l.cursor],
+		start: l.bot,
+		end:   l.cursor,
 	}
 
 	if kind, ok := keywords[token.value]; ok {
@@ -162,12 +499,62 @@ func (l *lexer_t) lexAtom() error {
 	}
 
 	if atomNameSize == 0 {
-		return fmt.Errorf("error: missing atom name at position %d", l.cursor)
+		return syntaxError(l.bot, l.cursor, "error: missing atom name at position %d", l.cursor)
 	}
 
 	token := token_t{
 		kind:  tk_atom,
 		value: l.content[l.bot:l.cursor],
+		start: l.bot,
+		end:   l.cursor,
+	}
+
+	l.tokens = append(l.tokens, token)
+
+	return nil
+}
+
+// Any name can be written between backticks, like `user agent` or `content-type`.
+// The value of the token is the name, without the backticks and the escapes
+func (l *lexer_t) lexQuotedSymbol() error {
+	l.forward()
+
+	name := make([]byte, 0)
+
+	for !l.isEmpty() && l.char() != '`' {
+		if l.char() == '\\' {
+			if l.isEmptyAhead() {
+				return syntaxError(l.bot, len(l.content), "error: unterminated quoted name at position %d", l.bot+1)
+			}
+
+			switch l.charAhead() {
+			case '`', '\\':
+				l.forward()
+			default:
+				return syntaxError(l.cursor, l.cursor+2, "error: invalid scape sequence at position %d", l.cursor+1)
+			}
+		}
+
+		name = append(name, l.char())
+
+		l.forward()
+	}
+
+	if l.isEmpty() {
+		return syntaxError(l.bot, len(l.content), "error: unterminated quoted name at position %d", l.bot+1)
+	}
+
+	l.forward()
+
+	if len(name) == 0 {
+		return syntaxError(l.bot, l.cursor, "error: missing name between backticks at position %d", l.bot+1)
+	}
+
+	token := token_t{
+		kind:  tk_quoted_symbol,
+		value: string(name),
+		start: l.bot,
+		end:   l.cursor,
 	}
 
 	l.tokens = append(l.tokens, token)
@@ -181,14 +568,14 @@ func (l *lexer_t) lexString() error {
 	for !l.isEmpty() && l.char() != '\'' {
 		if l.char() == '\\' {
 			if l.isEmptyAhead() {
-				return fmt.Errorf("error: unterminated string literal at position %d", l.bot+1)
+				return syntaxError(l.bot, len(l.content), "error: unterminated string literal at position %d", l.bot+1)
 			}
 
 			switch l.charAhead() {
 			case '\'', '\\':
 				l.forward()
 			default:
-				return fmt.Errorf("error: invalid scape sequence at position %d", l.cursor+1)
+				return syntaxError(l.cursor, l.cursor+2, "error: invalid scape sequence at position %d", l.cursor+1)
 			}
 		}
 
@@ -196,12 +583,14 @@ func (l *lexer_t) lexString() error {
 	}
 
 	if l.isEmpty() {
-		return fmt.Errorf("error: unterminated string literal at position %d", l.bot+1)
+		return syntaxError(l.bot, len(l.content), "error: unterminated string literal at position %d", l.bot+1)
 	}
 
 	token := token_t{
 		kind:  tk_string,
 		value: l.content[l.bot+1 : l.cursor],
+		start: l.bot,
+		end:   l.cursor + 1,
 	}
 
 	l.tokens = append(l.tokens, token)
@@ -228,21 +617,68 @@ func (l *lexer_t) lex() error {
 			if err := l.lexString(); err != nil {
 				return err
 			}
+		case '`':
+			if err := l.lexQuotedSymbol(); err != nil {
+				return err
+			}
 		case '(':
 			l.lexSingleChar(tk_open_paren)
 		case ')':
 			l.lexSingleChar(tk_close_paren)
+		case '[':
+			l.lexSingleChar(tk_open_bracket)
+		case ']':
+			l.lexSingleChar(tk_close_bracket)
+		case ',':
+			l.lexSingleChar(tk_comma)
+		case '+':
+			l.lexSingleChar(tk_plus)
+		case '-':
+			if l.isSignPosition() {
+				if err := l.lexNumber(); err != nil {
+					return err
+				}
+			} else {
+				l.lexSingleChar(tk_minus)
+			}
+		case '*':
+			l.lexSingleChar(tk_star)
+		case '/':
+			l.lexSingleChar(tk_slash)
+		case '%':
+			l.lexSingleChar(tk_percent)
+		case '.':
+			if err := l.lexRange(); err != nil {
+				return err
+			}
 		case ':':
-			if err := l.lexAtom(); err != nil {
+			if l.isAddressStart() {
+				if err := l.lexAddress(); err != nil {
+					return err
+				}
+			} else if err := l.lexAtom(); err != nil {
 				return err
 			}
 		default:
-			if isDigit(char) {
-				l.lexNumber()
+			if l.isTimeStart() {
+				if err := l.lexTime(); err != nil {
+					return err
+				}
+			} else if isHexDigit(char) && l.isAddressStart() {
+				if err := l.lexAddress(); err != nil {
+					return err
+				}
+			} else if isDigit(char) {
+				if err := l.lexNumber(); err != nil {
+					return err
+				}
 			} else if isSymbol(char) {
 				l.lexSymbolOrKeyword()
 			} else {
-				return fmt.Errorf("error: unexpected character \"%c\" at position %d", char, l.cursor+1)
+				// the whole character is reported, not only its first byte, like the 2 bytes of `é`
+				r, size := utf8.DecodeRuneInString(l.content[l.cursor:])
+
+				return syntaxError(l.cursor, l.cursor+size, "error: unexpected character \"%c\" at position %d", r, l.cursor+1)
 			}
 		}
 	}
@@ -54,18 +54,27 @@ func TestLexingFloats(t *testing.T) {
 
 func TestLexingKeywords(t *testing.T) {
 	var keywords = map[string]token_kind_t{
-		"true":  tk_true_keyword,
-		"false": tk_false_keyword,
-		"nil":   tk_nil_keyword,
-		"and":   tk_and_keyword,
-		"or":    tk_or_keyword,
-		"reg":   tk_reg_keyword,
-		"eq":    tk_eq_keyword,
-		"ne":    tk_ne_keyword,
-		"gt":    tk_gt_keyword,
-		"lt":    tk_lt_keyword,
-		"gte":   tk_gte_keyword,
-		"lte":   tk_lte_keyword,
+		"true":       tk_true_keyword,
+		"false":      tk_false_keyword,
+		"nil":        tk_nil_keyword,
+		"and":        tk_and_keyword,
+		"or":         tk_or_keyword,
+		"not":        tk_not_keyword,
+		"in":         tk_in_keyword,
+		"between":    tk_between_keyword,
+		"reg":        tk_reg_keyword,
+		"eq":         tk_eq_keyword,
+		"ne":         tk_ne_keyword,
+		"gt":         tk_gt_keyword,
+		"lt":         tk_lt_keyword,
+		"gte":        tk_gte_keyword,
+		"lte":        tk_lte_keyword,
+		"contains":   tk_contains_keyword,
+		"startswith": tk_startswith_keyword,
+		"endswith":   tk_endswith_keyword,
+		"ieq":        tk_ieq_keyword,
+		"icontains":  tk_icontains_keyword,
+		"like":       tk_like_keyword,
 	}
 
 	keys := make([]string, 0, len(keywords))
@@ -169,3 +178,364 @@ func TestLexingString(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, "error: unterminated string literal at position 4", err.Error())
 }
+
+func TestLexingPositions(t *testing.T) {
+	l := createLexer("(size  gt 10.5) or name reg 'a'")
+
+	err := l.lex()
+
+	assert.Nil(t, err)
+
+	starts := []int{0, 1, 7, 10, 14, 16, 19, 24, 28}
+	ends := []int{1, 5, 9, 14, 15, 18, 23, 27, 31}
+
+	assert.Equal(t, len(starts), len(l.tokens))
+
+	for i := range starts {
+		assert.Equal(t, starts[i], l.tokens[i].start, "token: %s", l.tokens[i].value)
+		assert.Equal(t, ends[i], l.tokens[i].end, "token: %s", l.tokens[i].value)
+	}
+
+	l = createLexer("size\tgt\n\r 10")
+
+	err = l.lex()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(l.tokens))
+	assert.Equal(t, 10, l.tokens[2].start)
+}
+
+func TestLexingLists(t *testing.T) {
+	l := createLexer("[1, 'a',:get]")
+
+	err := l.lex()
+
+	assert.Nil(t, err)
+
+	kinds := []token_kind_t{tk_open_bracket, tk_integer, tk_comma, tk_string, tk_comma, tk_atom, tk_close_bracket}
+
+	assert.Equal(t, len(kinds), len(l.tokens))
+
+	for i, kind := range kinds {
+		assert.Equal(t, kind, l.tokens[i].kind, "token: %s", l.tokens[i].value)
+	}
+}
+
+func TestLexingRanges(t *testing.T) {
+	l := createLexer("1..5 1..<5 1.5..2. a..b")
+
+	err := l.lex()
+
+	assert.Nil(t, err)
+
+	values := []string{"1", "..", "5", "1", "..<", "5", "1.5", "..", "2.", "a", "..", "b"}
+	kinds := []token_kind_t{tk_integer, tk_range, tk_integer, tk_integer, tk_range_exclusive, tk_integer, tk_float, tk_range, tk_float, tk_symbol, tk_range, tk_symbol}
+
+	assert.Equal(t, len(values), len(l.tokens))
+
+	for i := range values {
+		assert.Equal(t, values[i], l.tokens[i].value)
+		assert.Equal(t, kinds[i], l.tokens[i].kind, "token: %s", l.tokens[i].value)
+	}
+
+	l = createLexer("a . b")
+
+	err = l.lex()
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: unexpected character \".\" at position 3", err.Error())
+}
+
+func TestLexingArithmeticOperators(t *testing.T) {
+	l := createLexer("a+b - 1*2.5/c%3")
+
+	err := l.lex()
+
+	assert.Nil(t, err)
+
+	values := []string{"a", "+", "b", "-", "1", "*", "2.5", "/", "c", "%", "3"}
+	kinds := []token_kind_t{tk_symbol, tk_plus, tk_symbol, tk_minus, tk_integer, tk_star, tk_float, tk_slash, tk_symbol, tk_percent, tk_integer}
+
+	assert.Equal(t, len(values), len(l.tokens))
+
+	for i := range values {
+		assert.Equal(t, values[i], l.tokens[i].value)
+		assert.Equal(t, kinds[i], l.tokens[i].kind, "token: %s", l.tokens[i].value)
+	}
+}
+
+func TestLexingNumberLiterals(t *testing.T) {
+	tests := map[string]token_kind_t{
+		"-5":                   tk_integer,
+		"-0.5":                 tk_float,
+		"1e-3":                 tk_float,
+		"1E+3":                 tk_float,
+		"2.5e10":               tk_float,
+		"-1e3":                 tk_float,
+		"0xff":                 tk_integer,
+		"0X1F":                 tk_integer,
+		"-0x10":                tk_integer,
+		"0xFF_FF":              tk_integer,
+		"1_000_000":            tk_integer,
+		"1_000.000_1":          tk_float,
+		"-9223372036854775808": tk_integer,
+		"9223372036854775807":  tk_integer,
+	}
+
+	for test, kind := range tests {
+		l := createLexer(test)
+
+		err := l.lex()
+
+		assert.Nil(t, err, "test: %s", test)
+		assert.Equal(t, 1, len(l.tokens), "test: %s", test)
+		assert.Equal(t, kind, l.tokens[0].kind, "test: %s", test)
+		assert.Equal(t, test, l.tokens[0].value)
+	}
+}
+
+func TestLexingMinus(t *testing.T) {
+	type test_case_t struct {
+		query  string
+		values []string
+		kinds  []token_kind_t
+	}
+
+	tests := []test_case_t{
+		{query: "a lt -5", values: []string{"a", "lt", "-5"}, kinds: []token_kind_t{tk_symbol, tk_lt_keyword, tk_integer}},
+		{query: "a-5", values: []string{"a", "-", "5"}, kinds: []token_kind_t{tk_symbol, tk_minus, tk_integer}},
+		{query: "1 -2", values: []string{"1", "-", "2"}, kinds: []token_kind_t{tk_integer, tk_minus, tk_integer}},
+		{query: "(a)-2", values: []string{"(", "a", ")", "-", "2"}, kinds: []token_kind_t{tk_open_paren, tk_symbol, tk_close_paren, tk_minus, tk_integer}},
+		{query: "[-1,-2]", values: []string{"[", "-1", ",", "-2", "]"}, kinds: []token_kind_t{tk_open_bracket, tk_integer, tk_comma, tk_integer, tk_close_bracket}},
+		{query: "-5..-1", values: []string{"-5", "..", "-1"}, kinds: []token_kind_t{tk_integer, tk_range, tk_integer}},
+		{query: "2 - -1", values: []string{"2", "-", "-1"}, kinds: []token_kind_t{tk_integer, tk_minus, tk_integer}},
+		{query: "- 1", values: []string{"-", "1"}, kinds: []token_kind_t{tk_minus, tk_integer}},
+		{query: "-a", values: []string{"-", "a"}, kinds: []token_kind_t{tk_minus, tk_symbol}},
+		{query: "1e", values: []string{"1", "e"}, kinds: []token_kind_t{tk_integer, tk_symbol}},
+	}
+
+	for _, test := range tests {
+		l := createLexer(test.query)
+
+		err := l.lex()
+
+		assert.Nil(t, err, "test: %s", test.query)
+		assert.Equal(t, len(test.values), len(l.tokens), "test: %s", test.query)
+
+		for i := range test.values {
+			assert.Equal(t, test.values[i], l.tokens[i].value, "test: %s", test.query)
+			assert.Equal(t, test.kinds[i], l.tokens[i].kind, "test: %s", test.query)
+		}
+	}
+}
+
+func TestLexingInvalidNumbers(t *testing.T) {
+	tests := map[string]string{
+		"size gt 9223372036854775808":  "error: the integer \"9223372036854775808\" at position 9 is out of range",
+		"size gt -9223372036854775809": "error: the integer \"-9223372036854775809\" at position 9 is out of range",
+		"size gt 0x8000000000000000":   "error: the integer \"0x8000000000000000\" at position 9 is out of range",
+		"size gt 99999999999999999999": "error: the integer \"99999999999999999999\" at position 9 is out of range",
+		"size gt 1e309":                "error: the float \"1e309\" at position 9 is out of range",
+		"size gt -1.5e400":             "error: the float \"-1.5e400\" at position 9 is out of range",
+		"size gt 0x":                   "error: missing hexadecimal digits at position 9",
+		"size gt 1__000":               "error: invalid number \"1__000\" at position 9, underscores must be between digits",
+		"size gt 1000_":                "error: invalid number \"1000_\" at position 9, underscores must be between digits",
+		"size gt 1_.5":                 "error: invalid number \"1_.5\" at position 9, underscores must be between digits",
+		"size gt 1_e5":                 "error: invalid number \"1_e5\" at position 9, underscores must be between digits",
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		err := l.lex()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+	}
+}
+
+func TestLexingDottedPaths(t *testing.T) {
+	l := createLexer("request.headers.user_agent eq geo.country and a..b")
+
+	err := l.lex()
+
+	assert.Nil(t, err)
+
+	values := []string{"request.headers.user_agent", "eq", "geo.country", "and", "a", "..", "b"}
+	kinds := []token_kind_t{tk_symbol, tk_eq_keyword, tk_symbol, tk_and_keyword, tk_symbol, tk_range, tk_symbol}
+
+	assert.Equal(t, len(values), len(l.tokens))
+
+	for i := range values {
+		assert.Equal(t, values[i], l.tokens[i].value)
+		assert.Equal(t, kinds[i], l.tokens[i].kind, "token: %s", l.tokens[i].value)
+	}
+
+	l = createLexer("geo. country")
+
+	err = l.lex()
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: unexpected character \".\" at position 4", err.Error())
+}
+
+func TestLexingSymbolsWithDigits(t *testing.T) {
+	l := createLexer("http2 ipv4_addr p99 a1b2.c3 1abc")
+
+	err := l.lex()
+
+	assert.Nil(t, err)
+
+	values := []string{"http2", "ipv4_addr", "p99", "a1b2.c3", "1", "abc"}
+	kinds := []token_kind_t{tk_symbol, tk_symbol, tk_symbol, tk_symbol, tk_integer, tk_symbol}
+
+	assert.Equal(t, len(values), len(l.tokens))
+
+	for i := range values {
+		assert.Equal(t, values[i], l.tokens[i].value)
+		assert.Equal(t, kinds[i], l.tokens[i].kind, "token: %s", l.tokens[i].value)
+	}
+}
+
+func TestLexingQuotedSymbols(t *testing.T) {
+	l := createLexer("`user agent` eq `content-type` and `and` or `a\\`b\\\\c`")
+
+	err := l.lex()
+
+	assert.Nil(t, err)
+
+	values := []string{"user agent", "eq", "content-type", "and", "and", "or", "a`b\\c"}
+	kinds := []token_kind_t{tk_quoted_symbol, tk_eq_keyword, tk_quoted_symbol, tk_and_keyword, tk_quoted_symbol, tk_or_keyword, tk_quoted_symbol}
+
+	assert.Equal(t, len(values), len(l.tokens))
+
+	for i := range values {
+		assert.Equal(t, values[i], l.tokens[i].value)
+		assert.Equal(t, kinds[i], l.tokens[i].kind, "token: %s", l.tokens[i].value)
+	}
+
+	assert.Equal(t, 0, l.tokens[0].start)
+	assert.Equal(t, 12, l.tokens[0].end)
+
+	tests := map[string]string{
+		"`user agent": "error: unterminated quoted name at position 1",
+		"a eq `x\\":   "error: unterminated quoted name at position 6",
+		"``":          "error: missing name between backticks at position 1",
+		"`a\\b`":      "error: invalid scape sequence at position 3",
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		err := l.lex()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+	}
+}
+
+func TestLexingTimesAndDurations(t *testing.T) {
+	type test_case_t struct {
+		query  string
+		values []string
+		kinds  []token_kind_t
+	}
+
+	tests := []test_case_t{
+		{query: "ts gt 2024-05-01T00:00:00Z", values: []string{"ts", "gt", "2024-05-01T00:00:00Z"}, kinds: []token_kind_t{tk_symbol, tk_gt_keyword, tk_time}},
+		{query: "2024-05-01T10:20:30.5+02:00", values: []string{"2024-05-01T10:20:30.5+02:00"}, kinds: []token_kind_t{tk_time}},
+		{query: "2024-05-01T10:20:30-03:00", values: []string{"2024-05-01T10:20:30-03:00"}, kinds: []token_kind_t{tk_time}},
+		{query: "ts in 2024-05-01T00:00:00-03:00..2024-05-02T00:00:00Z", values: []string{"ts", "in", "2024-05-01T00:00:00-03:00", "..", "2024-05-02T00:00:00Z"}, kinds: []token_kind_t{tk_symbol, tk_in_keyword, tk_time, tk_range, tk_time}},
+		{query: "2024-05-01T00:00:00.5-03:00..<2024-05-02T00:00:00+02:00", values: []string{"2024-05-01T00:00:00.5-03:00", "..<", "2024-05-02T00:00:00+02:00"}, kinds: []token_kind_t{tk_time, tk_range_exclusive, tk_time}},
+		{query: "2024-05-01T00:00:00Z..2024-05-02T00:00:00Z", values: []string{"2024-05-01T00:00:00Z", "..", "2024-05-02T00:00:00Z"}, kinds: []token_kind_t{tk_time, tk_range, tk_time}},
+		{query: "2024-05-01T00:00:00Z-1h", values: []string{"2024-05-01T00:00:00Z", "-", "1h"}, kinds: []token_kind_t{tk_time, tk_minus, tk_duration}},
+		{query: "elapsed gte 250ms", values: []string{"elapsed", "gte", "250ms"}, kinds: []token_kind_t{tk_symbol, tk_gte_keyword, tk_duration}},
+		{query: "1h30m 1.5s 10us 5ns 1_000ms", values: []string{"1h30m", "1.5s", "10us", "5ns", "1_000ms"}, kinds: []token_kind_t{tk_duration, tk_duration, tk_duration, tk_duration, tk_duration}},
+		{query: "-5m", values: []string{"-5m"}, kinds: []token_kind_t{tk_duration}},
+		{query: "now() - 1h", values: []string{"now", "(", ")", "-", "1h"}, kinds: []token_kind_t{tk_symbol, tk_open_paren, tk_close_paren, tk_minus, tk_duration}},
+		{query: "1s..5s", values: []string{"1s", "..", "5s"}, kinds: []token_kind_t{tk_duration, tk_range, tk_duration}},
+		{query: "2024-05-01", values: []string{"2024", "-", "05", "-", "01"}, kinds: []token_kind_t{tk_integer, tk_minus, tk_integer, tk_minus, tk_integer}},
+		{query: "5x", values: []string{"5", "x"}, kinds: []token_kind_t{tk_integer, tk_symbol}},
+	}
+
+	for _, test := range tests {
+		l := createLexer(test.query)
+
+		err := l.lex()
+
+		assert.Nil(t, err, "test: %s", test.query)
+		assert.Equal(t, len(test.values), len(l.tokens), "test: %s", test.query)
+
+		for i := range test.values {
+			assert.Equal(t, test.values[i], l.tokens[i].value, "test: %s", test.query)
+			assert.Equal(t, test.kinds[i], l.tokens[i].kind, "test: %s", test.query)
+		}
+	}
+
+	fail_tests := map[string]string{
+		"ts gt 2024-13-01T00:00:00Z": "error: invalid time \"2024-13-01T00:00:00Z\" at position 7, expected a RFC3339 time like 2024-05-01T00:00:00Z",
+		"ts gt 2024-05-01T00:00":     "error: invalid time \"2024-05-01T00:00\" at position 7, expected a RFC3339 time like 2024-05-01T00:00:00Z",
+		"ts gt 2024-05-01T00:00:00-": "error: invalid time \"2024-05-01T00:00:00-\" at position 7, expected a RFC3339 time like 2024-05-01T00:00:00Z",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		err := l.lex()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+	}
+}
+
+func TestLexingAddresses(t *testing.T) {
+	type test_case_t struct {
+		query  string
+		values []string
+		kinds  []token_kind_t
+	}
+
+	tests := []test_case_t{
+		{query: "dst_ip eq 192.168.1.1", values: []string{"dst_ip", "eq", "192.168.1.1"}, kinds: []token_kind_t{tk_symbol, tk_eq_keyword, tk_ip}},
+		{query: "src_ip in 10.0.0.0/8", values: []string{"src_ip", "in", "10.0.0.0/8"}, kinds: []token_kind_t{tk_symbol, tk_in_keyword, tk_prefix}},
+		{query: "2001:db8::1", values: []string{"2001:db8::1"}, kinds: []token_kind_t{tk_ip}},
+		{query: "2001:db8::/32", values: []string{"2001:db8::/32"}, kinds: []token_kind_t{tk_prefix}},
+		{query: "fe80::1", values: []string{"fe80::1"}, kinds: []token_kind_t{tk_ip}},
+		{query: "::1", values: []string{"::1"}, kinds: []token_kind_t{tk_ip}},
+		{query: "::ffff:10.0.0.1", values: []string{"::ffff:10.0.0.1"}, kinds: []token_kind_t{tk_ip}},
+		{query: "ip in 10.0.0.1..10.0.0.9", values: []string{"ip", "in", "10.0.0.1", "..", "10.0.0.9"}, kinds: []token_kind_t{tk_symbol, tk_in_keyword, tk_ip, tk_range, tk_ip}},
+		{query: "method eq :add", values: []string{"method", "eq", ":add"}, kinds: []token_kind_t{tk_symbol, tk_eq_keyword, tk_atom}},
+		{query: "dead.beef.cafe.babe", values: []string{"dead.beef.cafe.babe"}, kinds: []token_kind_t{tk_symbol}},
+		{query: "1.5..2.5", values: []string{"1.5", "..", "2.5"}, kinds: []token_kind_t{tk_float, tk_range, tk_float}},
+	}
+
+	for _, test := range tests {
+		l := createLexer(test.query)
+
+		err := l.lex()
+
+		assert.Nil(t, err, "test: %s", test.query)
+		assert.Equal(t, len(test.values), len(l.tokens), "test: %s", test.query)
+
+		for i := range test.values {
+			assert.Equal(t, test.values[i], l.tokens[i].value, "test: %s", test.query)
+			assert.Equal(t, test.kinds[i], l.tokens[i].kind, "test: %s", test.query)
+		}
+	}
+
+	fail_tests := map[string]string{
+		"ip eq 256.1.1.1":      "error: invalid IP address \"256.1.1.1\" at position 7",
+		"ip eq 2001:db8:::1":   "error: invalid IP address \"2001:db8:::1\" at position 7",
+		"ip in 10.0.0.0/33":    "error: invalid IP prefix \"10.0.0.0/33\" at position 7",
+		"ip in 2001:db8::/129": "error: invalid IP prefix \"2001:db8::/129\" at position 7",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		err := l.lex()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+	}
+}
@@ -1,14 +1,18 @@
 package quang
 
 // TODO: "expect" a token, if it's the wrong one, inform the user.
-// TODO: categorize errors like: syntax error, logical error, ...
 import (
-	"fmt"
+	"math"
+	"net/netip"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type expression_kind_t int
 type binary_operator_t int
+type unary_operator_t int
 type AtomType int8
 type IntegerType int64
 type FloatType float64
@@ -20,16 +24,58 @@ type binary_expression_t struct {
 	right *expression_t
 }
 
+type unary_expression_t struct {
+	operator unary_operator_t
+
+	operand *expression_t
+}
+
+type set_key_t struct {
+	kind    expression_kind_t
+	integer IntegerType
+	float   FloatType
+	string  string
+	atom    AtomType
+}
+
+type list_expression_t struct {
+	items []*expression_t
+	// kind shared by all the items, ek_nil for empty lists
+	kind expression_kind_t
+	// lists of constants are turned into sets, so lookups are cheap
+	set map[set_key_t]struct{}
+}
+
+type range_expression_t struct {
+	low, high *expression_t
+	// when true, `high` is not part of the range
+	exclusive bool
+}
+
 type expression_t struct {
 	kind       expression_kind_t
 	symbolName string
 
-	bool    bool
-	float   FloatType
-	integer IntegerType
-	atom    AtomType
-	string  string
-	binary  *binary_expression_t
+	// byte offsets of the expression in the query, `end` is exclusive
+	start, end int
+
+	bool     bool
+	float    FloatType
+	integer  IntegerType
+	atom     AtomType
+	string   string
+	time     time.Time
+	duration time.Duration
+	ip       netip.Addr
+	prefix   netip.Prefix
+	binary   *binary_expression_t
+	unary    *unary_expression_t
+	list     *list_expression_t
+	interval *range_expression_t
+	call     *call_expression_t
+
+	// compiled pattern of string literals used as `reg` operands
+	regex *regexp.Regexp
 }
 
 type parser_t struct {
@@ -44,8 +90,16 @@ const (
 	ek_string
 	ek_atom
 	ek_bool
+	ek_time
+	ek_duration
+	ek_ip
+	ek_prefix
+	ek_list
+	ek_range
 
 	ek_binary
+	ek_unary
+	ek_call
 
 	ek_lazy_atom
 	ek_lazy_symbol
@@ -59,8 +113,26 @@ const (
 	bo_gte
 	bo_lte
 	bo_reg
+	bo_contains
+	bo_startswith
+	bo_endswith
+	bo_ieq
+	bo_icontains
+	bo_like
 	bo_and
 	bo_or
+	bo_in
+	bo_not_in
+	bo_add
+	bo_sub
+	bo_mul
+	bo_div
+	bo_mod
+)
+
+const (
+	uo_not unary_operator_t = iota
+	uo_neg
 )
 
 var ek_to_string = map[expression_kind_t]string{
@@ -70,27 +142,65 @@ var ek_to_string = map[expression_kind_t]string{
 	ek_string:      "string",
 	ek_atom:        "atom",
 	ek_bool:        "bool",
+	ek_time:        "time",
+	ek_duration:    "duration",
+	ek_ip:          "ip",
+	ek_prefix:      "prefix",
+	ek_list:        "list",
+	ek_range:       "range",
 	ek_binary:      "binary",
+	ek_unary:       "unary",
+	ek_call:        "call",
 	ek_lazy_atom:   "lazy_atom",
 	ek_lazy_symbol: "lazy_symbol",
 }
 
 var bo_to_string = map[binary_operator_t]string{
-	bo_eq:  "eq",
-	bo_ne:  "ne",
-	bo_gt:  "gt",
-	bo_lt:  "lt",
-	bo_gte: "gte",
-	bo_lte: "lte",
-	bo_reg: "reg",
-	bo_and: "and",
-	bo_or:  "or",
+	bo_eq:         "eq",
+	bo_ne:         "ne",
+	bo_gt:         "gt",
+	bo_lt:         "lt",
+	bo_gte:        "gte",
+	bo_lte:        "lte",
+	bo_reg:        "reg",
+	bo_contains:   "contains",
+	bo_startswith: "startswith",
+	bo_endswith:   "endswith",
+	bo_ieq:        "ieq",
+	bo_icontains:  "icontains",
+	bo_like:       "like",
+	bo_and:        "and",
+	bo_or:         "or",
+	bo_in:         "in",
+	bo_not_in:     "not in",
+	bo_add:        "+",
+	bo_sub:        "-",
+	bo_mul:        "*",
+	bo_div:        "/",
+	bo_mod:        "%",
+}
+
+var uo_to_string = map[unary_operator_t]string{
+	uo_not: "not",
+	uo_neg: "-",
 }
 
 func lexerTokenKindToBinaryOperator(kind token_kind_t) binary_operator_t {
 	switch kind {
 	case tk_reg_keyword:
 		return bo_reg
+	case tk_contains_keyword:
+		return bo_contains
+	case tk_startswith_keyword:
+		return bo_startswith
+	case tk_endswith_keyword:
+		return bo_endswith
+	case tk_ieq_keyword:
+		return bo_ieq
+	case tk_icontains_keyword:
+		return bo_icontains
+	case tk_like_keyword:
+		return bo_like
 	case tk_eq_keyword:
 		return bo_eq
 	case tk_ne_keyword:
@@ -107,19 +217,47 @@ func lexerTokenKindToBinaryOperator(kind token_kind_t) binary_operator_t {
 		return bo_and
 	case tk_or_keyword:
 		return bo_or
+	case tk_in_keyword:
+		return bo_in
+	case tk_plus:
+		return bo_add
+	case tk_minus:
+		return bo_sub
+	case tk_star:
+		return bo_mul
+	case tk_slash:
+		return bo_div
+	case tk_percent:
+		return bo_mod
 	}
 
 	panic("unreacheable: invalid token kind")
 }
 
+// Accepts underscores between digits (`1_000`) and hexadecimal integers (`0xff`)
 func parseInteger(n string) (int64, error) {
-	v, err := strconv.ParseInt(n, 10, 64)
+	n = strings.ReplaceAll(n, "_", "")
 
-	return v, err
+	sign := ""
+
+	if strings.HasPrefix(n, "-") {
+		sign = "-"
+		n = n[1:]
+	}
+
+	if strings.HasPrefix(n, "0x") || strings.HasPrefix(n, "0X") {
+		return strconv.ParseInt(sign+n[2:], 16, 64)
+	}
+
+	return strconv.ParseInt(sign+n, 10, 64)
+}
+
+func parseDuration(n string) (time.Duration, error) {
+	return time.ParseDuration(strings.ReplaceAll(n, "_", ""))
 }
 
 func parseFloat(n string) (float64, error) {
-	v, err := strconv.ParseFloat(n, 64)
+	v, err := strconv.ParseFloat(strings.ReplaceAll(n, "_", ""), 64)
 
 	return v, err
 }
@@ -174,9 +312,18 @@ func (p *parser_t) forward() {
 	p.current_token++
 }
 
+// Offset right after the last token, used to report errors at the end of the query
+func (p parser_t) endOffset() int {
+	if len(p.tokens) == 0 {
+		return 0
+	}
+
+	return p.tokens[len(p.tokens)-1].end
+}
+
 func (p *parser_t) parsePrimary() (*expression_t, error) {
 	if p.isEmpty() {
-		return nil, fmt.Errorf("error: missing token")
+		return nil, syntaxError(p.endOffset(), p.endOffset(), "error: missing token")
 	}
 
 	current := p.token()
@@ -189,12 +336,14 @@ func (p *parser_t) parsePrimary() (*expression_t, error) {
 			integer, err := parseInteger(current.value)
 
 			if err != nil {
-				return nil, fmt.Errorf("error: could not parse \"%s\" as integer due to %s", current.value, err.Error())
+				return nil, syntaxError(current.start, current.end, "error: could not parse \"%s\" as integer due to %s", current.value, err.Error())
 			}
 
 			return &expression_t{
 				kind:       ek_integer,
 				symbolName: "",
+				start:      current.start,
+				end:        current.end,
 				integer:    IntegerType(integer),
 			}, nil
 		}
@@ -203,20 +352,84 @@ func (p *parser_t) parsePrimary() (*expression_t, error) {
 			float, err := parseFloat(current.value)
 
 			if err != nil {
-				return nil, fmt.Errorf("error: could not parse \"%s\" as float due to %s", current.value, err.Error())
+				return nil, syntaxError(current.start, current.end, "error: could not parse \"%s\" as float due to %s", current.value, err.Error())
 			}
 
 			return &expression_t{
 				kind:       ek_float,
 				symbolName: "",
+				start:      current.start,
+				end:        current.end,
 				float:      FloatType(float),
 			}, nil
 		}
+	case tk_time:
+		{
+			value, err := time.Parse(time.RFC3339, current.value)
+
+			if err != nil {
+				return nil, syntaxError(current.start, current.end, "error: could not parse \"%s\" as time due to %s", current.value, err.Error())
+			}
+
+			return &expression_t{
+				kind:  ek_time,
+				start: current.start,
+				end:   current.end,
+				time:  value,
+			}, nil
+		}
+	case tk_duration:
+		{
+			duration, err := parseDuration(current.value)
+
+			if err != nil {
+				return nil, syntaxError(current.start, current.end, "error: could not parse \"%s\" as duration due to %s", current.value, err.Error())
+			}
+
+			return &expression_t{
+				kind:     ek_duration,
+				start:    current.start,
+				end:      current.end,
+				duration: duration,
+			}, nil
+		}
+	case tk_ip:
+		{
+			ip, err := netip.ParseAddr(current.value)
+
+			if err != nil {
+				return nil, syntaxError(current.start, current.end, "error: could not parse \"%s\" as IP address due to %s", current.value, err.Error())
+			}
+
+			return &expression_t{
+				kind:  ek_ip,
+				start: current.start,
+				end:   current.end,
+				ip:    ip.Unmap(),
+			}, nil
+		}
+	case tk_prefix:
+		{
+			prefix, err := netip.ParsePrefix(current.value)
+
+			if err != nil {
+				return nil, syntaxError(current.start, current.end, "error: could not parse \"%s\" as IP prefix due to %s", current.value, err.Error())
+			}
+
+			return &expression_t{
+				kind:   ek_prefix,
+				start:  current.start,
+				end:    current.end,
+				prefix: prefix.Masked(),
+			}, nil
+		}
 	case tk_true_keyword, tk_false_keyword:
 		{
 			return &expression_t{
 				kind:       ek_bool,
 				symbolName: "",
+				start:      current.start,
+				end:        current.end,
 				bool:       parseBool(current.value),
 			}, nil
 		}
@@ -225,13 +438,21 @@ func (p *parser_t) parsePrimary() (*expression_t, error) {
 			return &expression_t{
 				kind:       ek_lazy_atom,
 				symbolName: current.value,
+				start:      current.start,
+				end:        current.end,
 			}, nil
 		}
-	case tk_symbol:
+	case tk_symbol, tk_quoted_symbol:
 		{
+			if current.kind == tk_symbol && !p.isEmpty() && p.token().kind == tk_open_paren {
+				return p.parseCall(current)
+			}
+
 			return &expression_t{
 				kind:       ek_lazy_symbol,
 				symbolName: current.value,
+				start:      current.start,
+				end:        current.end,
 			}, nil
 		}
 	case tk_nil_keyword:
@@ -239,43 +460,642 @@ func (p *parser_t) parsePrimary() (*expression_t, error) {
 			return &expression_t{
 				kind:       ek_nil,
 				symbolName: "",
+				start:      current.start,
+				end:        current.end,
 			}, nil
 		}
+	case tk_open_bracket:
+		return p.parseList(current)
 	case tk_string:
 		{
 			return &expression_t{
 				kind:       ek_string,
 				symbolName: "",
+				start:      current.start,
+				end:        current.end,
 				string:     unescapeString(current.value),
 			}, nil
 		}
 	}
 
-	return nil, fmt.Errorf("error: unexpected token \"%s\"", current.value)
+	return nil, syntaxError(current.start, current.end, "error: unexpected token \"%s\"", current.value)
+}
+
+// Numbers are keyed by their value, whatever their type is, so `1 in [1.0]` works just like `1 eq 1.0`
+func setKey(expr *expression_t) set_key_t {
+	switch expr.kind {
+	case ek_integer:
+		return set_key_t{kind: ek_integer, integer: expr.integer}
+	case ek_float:
+		if expr.float == FloatType(math.Trunc(float64(expr.float))) && expr.float >= math.MinInt64 && expr.float < math.MaxInt64 {
+			return set_key_t{kind: ek_integer, integer: IntegerType(expr.float)}
+		}
+
+		return set_key_t{kind: ek_float, float: expr.float}
+	case ek_string:
+		return set_key_t{kind: ek_string, string: expr.string}
+	case ek_atom:
+		return set_key_t{kind: ek_atom, atom: expr.atom}
+	}
+
+	panic("unreacheable: invalid set key kind")
+}
+
+// `[` was already consumed
+func (p *parser_t) parseList(open token_t) (*expression_t, error) {
+	list := &list_expression_t{
+		items: make([]*expression_t, 0),
+		kind:  ek_nil,
+	}
+
+	for {
+		if p.isEmpty() {
+			return nil, syntaxError(p.endOffset(), p.endOffset(), "error: expected ']' but got end of query")
+		}
+
+		if p.token().kind == tk_close_bracket {
+			break
+		}
+
+		item, err := p.parsePrimary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		kind := item.kind
+
+		switch kind {
+		case ek_lazy_atom:
+			kind = ek_atom
+		case ek_integer, ek_float, ek_string:
+		default:
+			return nil, syntaxError(item.start, item.end, "error: lists can only have integers, floats, strings and atoms, but got %s", ek_to_string[item.kind])
+		}
+
+		if list.kind == ek_nil || (isNumberKind(list.kind) && isNumberKind(kind)) {
+			if list.kind != ek_float {
+				list.kind = kind
+			}
+		} else if list.kind != kind {
+			return nil, syntaxError(item.start, item.end, "error: all the list items must have the same type, expected %s but got %s", ek_to_string[list.kind], ek_to_string[kind])
+		}
+
+		list.items = append(list.items, item)
+
+		if p.isEmpty() {
+			return nil, syntaxError(p.endOffset(), p.endOffset(), "error: expected ']' but got end of query")
+		}
+
+		separator := p.token()
+
+		if separator.kind == tk_close_bracket {
+			break
+		}
+
+		if separator.kind != tk_comma {
+			return nil, syntaxError(separator.start, separator.end, "error: expected ',' or ']' but got \"%s\"", separator.value)
+		}
+
+		p.forward()
+	}
+
+	closing := p.token()
+
+	p.forward()
+
+	// atoms are only known after parsing, their sets are built by `buildAtomSets`
+	if list.kind != ek_atom {
+		list.set = make(map[set_key_t]struct{}, len(list.items))
+
+		for _, item := range list.items {
+			list.set[setKey(item)] = struct{}{}
+		}
+	}
+
+	return &expression_t{
+		kind:  ek_list,
+		start: open.start,
+		end:   closing.end,
+		list:  list,
+	}, nil
+}
+
+// Turns the lists of atoms into sets once the atoms are known, like in `Compile`.
+// Lists with unknown atoms are left as they are, so evaluating them reports the atom
+func buildAtomSets(expr *expression_t, atoms map[string]AtomType) {
+	if expr == nil {
+		return
+	}
+
+	switch expr.kind {
+	case ek_binary:
+		buildAtomSets(expr.binary.left, atoms)
+		buildAtomSets(expr.binary.right, atoms)
+	case ek_unary:
+		buildAtomSets(expr.unary.operand, atoms)
+	case ek_range:
+		buildAtomSets(expr.interval.low, atoms)
+		buildAtomSets(expr.interval.high, atoms)
+	case ek_call:
+		for _, arg := range expr.call.args {
+			buildAtomSets(arg, atoms)
+		}
+	case ek_list:
+		{
+			if expr.list.kind != ek_atom {
+				return
+			}
+
+			set := make(map[set_key_t]struct{}, len(expr.list.items))
+
+			for _, item := range expr.list.items {
+				atom, ok := atoms[item.symbolName]
+
+				if !ok {
+					return
+				}
+
+				set[set_key_t{kind: ek_atom, atom: atom}] = struct{}{}
+			}
+
+			expr.list.set = set
+		}
+	}
+}
+
+// Kind of an expression when it's known before evaluating the query,
+// false when it depends on variables
+func constantKind(expr *expression_t) (expression_kind_t, bool) {
+	switch expr.kind {
+	case ek_nil, ek_integer, ek_float, ek_string, ek_bool, ek_time, ek_duration, ek_ip, ek_prefix, ek_list:
+		return expr.kind, true
+	case ek_call:
+		{
+			// the condition of quantifiers depends on the items
+			if expr.call.function.predicate {
+				return ek_bool, false
+			}
+
+			kinds := make([]expression_kind_t, 0, len(expr.call.args))
+
+			for _, arg := range expr.call.args {
+				kind, ok := constantKind(arg)
+
+				if !ok {
+					return ek_nil, false
+				}
+
+				kinds = append(kinds, kind)
+			}
+
+			return expr.call.function.kind(kinds)
+		}
+	}
+
+	return ek_nil, false
+}
+
+// The function name was already consumed and the current token is `(`
+func (p *parser_t) parseCall(name token_t) (*expression_t, error) {
+	function, ok := functions[name.value]
+
+	if !ok {
+		return nil, syntaxError(name.start, name.end, "error: the function '%s' does not exist at position %d", name.value, name.start+1)
+	}
+
+	p.forward()
+
+	args := make([]*expression_t, 0)
+
+	for {
+		if p.isEmpty() {
+			return nil, syntaxError(p.endOffset(), p.endOffset(), "error: expected ')' but got end of query")
+		}
+
+		if p.token().kind == tk_close_paren {
+			break
+		}
+
+		var arg *expression_t
+		var err error
+
+		// the arguments after the list of `any` and `all` are conditions checked for each item
+		if function.predicate && len(args) > 0 {
+			arg, err = p.parseExpression()
+		} else {
+			arg, err = p.parseArithmetic(nil)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+
+		if p.isEmpty() {
+			return nil, syntaxError(p.endOffset(), p.endOffset(), "error: expected ')' but got end of query")
+		}
+
+		separator := p.token()
+
+		if separator.kind == tk_close_paren {
+			break
+		}
+
+		if separator.kind != tk_comma {
+			return nil, syntaxError(separator.start, separator.end, "error: expected ',' or ')' but got \"%s\"", separator.value)
+		}
+
+		p.forward()
+	}
+
+	closing := p.token()
+
+	p.forward()
+
+	expr := &expression_t{
+		kind:       ek_call,
+		symbolName: name.value,
+		start:      name.start,
+		end:        closing.end,
+		call: &call_expression_t{
+			function: function,
+			args:     args,
+		},
+	}
+
+	if len(args) < function.minArgs || (function.maxArgs >= 0 && len(args) > function.maxArgs) {
+		return nil, syntaxError(expr.start, expr.end, "error: the function '%s' takes %s but got %d at position %d", function.name, describeArity(function), len(args), expr.start+1)
+	}
+
+	kinds := make([]expression_kind_t, 0, len(args))
+
+	for _, arg := range args {
+		kind, ok := constantKind(arg)
+
+		if !ok {
+			// the arguments are checked once they are evaluated
+			return expr, nil
+		}
+
+		kinds = append(kinds, kind)
+	}
+
+	if _, ok := function.kind(kinds); !ok {
+		return nil, typeError(expr, "error: you cannot call %s at position %d", callSignature(function, kinds), expr.start+1)
+	}
+
+	return expr, nil
+}
+
+func createRange(low, high *expression_t, exclusive bool) *expression_t {
+	return &expression_t{
+		kind:  ek_range,
+		start: low.start,
+		end:   high.end,
+		interval: &range_expression_t{
+			low:       low,
+			high:      high,
+			exclusive: exclusive,
+		},
+	}
+}
+
+func (p *parser_t) parseRangeBound() (*expression_t, error) {
+	bound, err := p.parseArithmetic(nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bound.kind == ek_list {
+		return nil, syntaxError(bound.start, bound.end, "error: range bounds cannot be lists")
+	}
+
+	return bound, nil
+}
+
+// `in` is followed by a list (`[1, 2]`) or by a range (`1..5` or `1..<5`)
+func (p *parser_t) parseIn() (*expression_t, error) {
+	p.forward()
+
+	right, err := p.parseArithmetic(nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// `src_ip in 10.0.0.0/8` tells if the address belongs to the network
+	if right.kind == ek_list || right.kind == ek_prefix {
+		return right, nil
+	}
+
+	if p.isEmpty() || (p.token().kind != tk_range && p.token().kind != tk_range_exclusive) {
+		return nil, syntaxError(right.start, right.end, "error: expected a list, a range or an IP prefix after 'in'")
+	}
+
+	exclusive := p.token().kind == tk_range_exclusive
+
+	p.forward()
+
+	high, err := p.parseRangeBound()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return createRange(right, high, exclusive), nil
+}
+
+// `a between b and c` is the same as `a in b..c`. The `and` here is part of
+// the comparison, so it's consumed before `parseTerm` can take it as a logical and
+func (p *parser_t) parseBetween() (*expression_t, error) {
+	p.forward()
+
+	low, err := p.parseRangeBound()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isEmpty() {
+		return nil, syntaxError(p.endOffset(), p.endOffset(), "error: expected 'and' after the lower bound of 'between' but got end of query")
+	}
+
+	if p.token().kind != tk_and_keyword {
+		current := p.token()
+
+		return nil, syntaxError(current.start, current.end, "error: expected 'and' after the lower bound of 'between' but got \"%s\"", current.value)
+	}
+
+	p.forward()
+
+	high, err := p.parseRangeBound()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return createRange(low, high, false), nil
+}
+
+func isArithmeticOperator(op binary_operator_t) bool {
+	switch op {
+	case bo_add, bo_sub, bo_mul, bo_div, bo_mod:
+		return true
+	}
+
+	return false
+}
+
+// Tokens that can follow the left side of a comparison
+func isOperatorToken(kind token_kind_t) bool {
+	switch kind {
+	case tk_eq_keyword, tk_ne_keyword, tk_gt_keyword, tk_lt_keyword, tk_gte_keyword, tk_lte_keyword, tk_reg_keyword,
+		tk_contains_keyword, tk_startswith_keyword, tk_endswith_keyword, tk_ieq_keyword, tk_icontains_keyword, tk_like_keyword,
+		tk_in_keyword, tk_between_keyword, tk_not_keyword,
+		tk_plus, tk_minus, tk_star, tk_slash, tk_percent:
+		return true
+	}
+
+	return false
+}
+
+// Expressions that evaluate to a value instead of a condition,
+// so they can be used as operands
+func isValueExpression(expr *expression_t) bool {
+	switch expr.kind {
+	case ek_binary:
+		return isArithmeticOperator(expr.binary.operator)
+	case ek_unary:
+		return expr.unary.operator == uo_neg
+	}
+
+	return true
+}
+
+func isArithmeticToken(kind token_kind_t) bool {
+	switch kind {
+	case tk_plus, tk_minus, tk_star, tk_slash, tk_percent:
+		return true
+	}
+
+	return false
+}
+
+func (p *parser_t) parseArithmeticOperand() (*expression_t, error) {
+	// negative literals are lexed as a whole, this is the minus of anything else, like `-offset`
+	if !p.isEmpty() && p.token().kind == tk_minus {
+		current := p.token()
+
+		p.forward()
+
+		operand, err := p.parseArithmeticOperand()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if operand.kind == ek_list {
+			return nil, syntaxError(operand.start, operand.end, "error: lists cannot be used in arithmetic expressions")
+		}
+
+		return &expression_t{
+			kind:  ek_unary,
+			start: current.start,
+			end:   operand.end,
+			unary: &unary_expression_t{
+				operator: uo_neg,
+				operand:  operand,
+			},
+		}, nil
+	}
+
+	// only arithmetic is allowed between these parenthesis, like in `duration / (1000 * 60)`,
+	// parenthesis around conditions are handled by `parseFactor`
+	if !p.isEmpty() && p.token().kind == tk_open_paren {
+		open := p.token()
+
+		p.forward()
+
+		operand, err := p.parseArithmetic(nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.isEmpty() {
+			return nil, syntaxError(p.endOffset(), p.endOffset(), "error: expected ')' but got end of query")
+		}
+
+		closing := p.token()
+
+		if closing.kind != tk_close_paren {
+			return nil, syntaxError(closing.start, closing.end, "error: expected ')' but got \"%s\"", closing.value)
+		}
+
+		p.forward()
+
+		operand.start = open.start
+		operand.end = closing.end
+
+		return operand, nil
+	}
+
+	operand, err := p.parsePrimary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if operand.kind == ek_list && !p.isEmpty() && isArithmeticToken(p.token().kind) {
+		return nil, syntaxError(operand.start, operand.end, "error: lists cannot be used in arithmetic expressions")
+	}
+
+	return operand, nil
+}
+
+// `*`, `/` and `%` bind tighter than `+` and `-`.
+// `left` is the first operand when it was already parsed, like in `(a + b) * 2`
+func (p *parser_t) parseMultiplicative(left *expression_t) (*expression_t, error) {
+	if left == nil {
+		operand, err := p.parseArithmeticOperand()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = operand
+	}
+
+	for !p.isEmpty() {
+		current := p.token()
+
+		if current.kind != tk_star && current.kind != tk_slash && current.kind != tk_percent {
+			break
+		}
+
+		p.forward()
+
+		right, err := p.parseArithmeticOperand()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if right.kind == ek_list {
+			return nil, syntaxError(right.start, right.end, "error: lists cannot be used in arithmetic expressions")
+		}
+
+		left = &expression_t{
+			kind:  ek_binary,
+			start: left.start,
+			end:   right.end,
+			binary: &binary_expression_t{
+				operator: lexerTokenKindToBinaryOperator(current.kind),
+				left:     left,
+				right:    right,
+			},
+		}
+	}
+
+	return left, nil
 }
 
-func (p *parser_t) parseComparison() (*expression_t, error) {
-	left, err := p.parsePrimary()
+// Operands of comparisons, arithmetic binds tighter than the comparison operators,
+// so `a + b gt c` is `(a + b) gt c`
+func (p *parser_t) parseArithmetic(left *expression_t) (*expression_t, error) {
+	left, err := p.parseMultiplicative(left)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for !p.isEmpty() {
+		current := p.token()
+
+		if current.kind != tk_plus && current.kind != tk_minus {
+			break
+		}
+
+		p.forward()
+
+		right, err := p.parseMultiplicative(nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if right.kind == ek_list {
+			return nil, syntaxError(right.start, right.end, "error: lists cannot be used in arithmetic expressions")
+		}
+
+		left = &expression_t{
+			kind:  ek_binary,
+			start: left.start,
+			end:   right.end,
+			binary: &binary_expression_t{
+				operator: lexerTokenKindToBinaryOperator(current.kind),
+				left:     left,
+				right:    right,
+			},
+		}
+	}
+
+	return left, nil
+}
+
+// `left` is the left side when it was already parsed, like in `(a + b) gt c`
+func (p *parser_t) parseComparison(left *expression_t) (*expression_t, error) {
+	left, err := p.parseArithmetic(left)
+
+	if err != nil {
+		return nil, err
+	}
 
 	if p.isEmpty() {
-		return left, err
+		return left, nil
 	}
 
 	current := p.token()
 
 	switch current.kind {
-	case tk_eq_keyword, tk_ne_keyword, tk_gt_keyword, tk_lt_keyword, tk_gte_keyword, tk_lte_keyword, tk_reg_keyword:
+	case tk_eq_keyword, tk_ne_keyword, tk_gt_keyword, tk_lt_keyword, tk_gte_keyword, tk_lte_keyword, tk_reg_keyword,
+		tk_contains_keyword, tk_startswith_keyword, tk_endswith_keyword, tk_ieq_keyword, tk_icontains_keyword, tk_like_keyword:
 		{
 			p.forward()
 
-			right, err := p.parsePrimary()
+			right, err := p.parseArithmetic(nil)
 
 			if err != nil {
 				return nil, err
 			}
 
+			if current.kind == tk_reg_keyword && right.kind == ek_string {
+				regex, err := regexp.Compile(right.string)
+
+				if err != nil {
+					return nil, syntaxError(right.start, right.end, "error: invalid regex pattern '%s' at position %d: %s", right.string, right.start+1, err.Error())
+				}
+
+				right.regex = regex
+			}
+
+			if current.kind == tk_like_keyword && right.kind == ek_string {
+				glob, err := compileGlob(right.string)
+
+				if err != nil {
+					return nil, syntaxError(right.start, right.end, "error: invalid glob pattern '%s' at position %d: %s", right.string, right.start+1, err.Error())
+				}
+
+				right.regex = glob
+			}
+
 			return &expression_t{
-				kind: ek_binary,
+				kind:  ek_binary,
+				start: left.start,
+				end:   right.end,
 				binary: &binary_expression_t{
 					operator: lexerTokenKindToBinaryOperator(current.kind),
 					left:     left,
@@ -283,16 +1103,81 @@ func (p *parser_t) parseComparison() (*expression_t, error) {
 				},
 			}, nil
 		}
+	case tk_in_keyword, tk_between_keyword, tk_not_keyword:
+		{
+			negated := current.kind == tk_not_keyword
+
+			if negated {
+				p.forward()
+
+				if p.isEmpty() || (p.token().kind != tk_in_keyword && p.token().kind != tk_between_keyword) {
+					return nil, syntaxError(current.start, current.end, "error: expected 'in' or 'between' after 'not'")
+				}
+			}
+
+			var right *expression_t
+
+			if p.token().kind == tk_between_keyword {
+				right, err = p.parseBetween()
+			} else {
+				right, err = p.parseIn()
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			operator := bo_in
+
+			if negated {
+				operator = bo_not_in
+			}
+
+			return &expression_t{
+				kind:  ek_binary,
+				start: left.start,
+				end:   right.end,
+				binary: &binary_expression_t{
+					operator: operator,
+					left:     left,
+					right:    right,
+				},
+			}, nil
+		}
 	case tk_or_keyword, tk_and_keyword, tk_close_paren:
 		return left, nil
 	}
 
-	return nil, fmt.Errorf("error: expected comparison operator after expression but got \"%s\"", current.value)
+	return nil, syntaxError(current.start, current.end, "error: expected comparison operator after expression but got \"%s\"", current.value)
 }
 
 func (p *parser_t) parseFactor() (*expression_t, error) {
+	if p.isEmpty() {
+		return nil, syntaxError(p.endOffset(), p.endOffset(), "error: missing token")
+	}
+
 	current := p.token()
 
+	if current.kind == tk_not_keyword {
+		p.forward()
+
+		operand, err := p.parseFactor()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &expression_t{
+			kind:  ek_unary,
+			start: current.start,
+			end:   operand.end,
+			unary: &unary_expression_t{
+				operator: uo_not,
+				operand:  operand,
+			},
+		}, nil
+	}
+
 	if current.kind == tk_open_paren {
 		p.forward()
 
@@ -302,16 +1187,32 @@ func (p *parser_t) parseFactor() (*expression_t, error) {
 			return nil, err
 		}
 
-		if p.token().kind != tk_close_paren {
-			return nil, fmt.Errorf("error: expected ')' but got \"%s\"", p.token().value)
+		if p.isEmpty() {
+			return nil, syntaxError(p.endOffset(), p.endOffset(), "error: expected ')' but got end of query")
+		}
+
+		closing := p.token()
+
+		if closing.kind != tk_close_paren {
+			return nil, syntaxError(closing.start, closing.end, "error: expected ')' but got \"%s\"", closing.value)
 		}
 
 		p.forward()
 
+		if expr != nil {
+			expr.start = current.start
+			expr.end = closing.end
+
+			// in `(a + b) * 2 gt c` the parenthesis are part of an operand
+			if isValueExpression(expr) && !p.isEmpty() && isOperatorToken(p.token().kind) {
+				return p.parseComparison(expr)
+			}
+		}
+
 		return expr, nil
 	}
 
-	return p.parseComparison()
+	return p.parseComparison(nil)
 }
 
 func (p *parser_t) parseTerm() (*expression_t, error) {
@@ -337,7 +1238,9 @@ func (p *parser_t) parseTerm() (*expression_t, error) {
 		}
 
 		left = &expression_t{
-			kind: ek_binary,
+			kind:  ek_binary,
+			start: left.start,
+			end:   right.end,
 			binary: &binary_expression_t{
 				operator: bo_and,
 				left:     left,
@@ -376,7 +1279,9 @@ func (p *parser_t) parseExpression() (*expression_t, error) {
 		}
 
 		left = &expression_t{
-			kind: ek_binary,
+			kind:  ek_binary,
+			start: left.start,
+			end:   right.end,
 			binary: &binary_expression_t{
 				operator: bo_or,
 				left:     left,
@@ -387,3 +1292,20 @@ func (p *parser_t) parseExpression() (*expression_t, error) {
 
 	return left, nil
 }
+
+// Parses the whole query, complaining about any token left behind
+func (p *parser_t) parse() (*expression_t, error) {
+	expr, err := p.parseExpression()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isEmpty() {
+		current := p.token()
+
+		return nil, syntaxError(current.start, current.end, "error: unexpected token \"%s\" at position %d", current.value, current.start+1)
+	}
+
+	return expr, nil
+}
@@ -15,7 +15,7 @@ func TestParseComparison(t *testing.T) {
 	assert.Nil(t, err)
 
 	p := createParser(l.tokens)
-	expr, err := p.parseComparison()
+	expr, err := p.parseComparison(nil)
 
 	assert.Nil(t, err)
 
@@ -97,3 +97,422 @@ func TestParseExpression(t *testing.T) {
 		assert.Nil(t, err)
 	}
 }
+
+func TestParseNot(t *testing.T) {
+	data := "not (method eq :get or size gt 0)"
+
+	l := createLexer(data)
+	err := l.lex()
+
+	assert.Nil(t, err)
+
+	p := createParser(l.tokens)
+	expr, err := p.parseExpression()
+
+	assert.Nil(t, err)
+	assert.Equal(t, ek_unary, expr.kind)
+	assert.Equal(t, uo_not, expr.unary.operator)
+	assert.Equal(t, ek_binary, expr.unary.operand.kind)
+	assert.Equal(t, bo_or, expr.unary.operand.binary.operator)
+
+	for _, test := range []string{"not", "not (true", "true and not"} {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+		_, err := p.parseExpression()
+
+		assert.NotNil(t, err, "test: %s", test)
+	}
+}
+
+func TestParseRegexLiterals(t *testing.T) {
+	l := createLexer("agent reg '^curl/[0-9]+'")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+	expr, err := p.parseExpression()
+
+	assert.Nil(t, err)
+	assert.NotNil(t, expr.binary.right.regex)
+
+	l = createLexer("agent eq '^curl/[0-9]+'")
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+	expr, err = p.parseExpression()
+
+	assert.Nil(t, err)
+	assert.Nil(t, expr.binary.right.regex)
+
+	l = createLexer("size gt 0 and agent reg '(curl'")
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+	expr, err = p.parseExpression()
+
+	assert.Nil(t, expr)
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: invalid regex pattern '(curl' at position 25: error parsing regexp: missing closing ): `(curl`", err.Error())
+}
+
+func TestParseGlobLiterals(t *testing.T) {
+	l := createLexer("host like '*.internal'")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+	expr, err := p.parseExpression()
+
+	assert.Nil(t, err)
+	assert.Equal(t, bo_like, expr.binary.operator)
+	assert.NotNil(t, expr.binary.right.regex)
+	assert.Equal(t, "(?s)^.*\\.internal$", expr.binary.right.regex.String())
+
+	l = createLexer("host like pattern")
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+	expr, err = p.parseExpression()
+
+	assert.Nil(t, err)
+	assert.Nil(t, expr.binary.right.regex)
+
+	l = createLexer("size gt 0 and host like '[abc'")
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+	expr, err = p.parseExpression()
+
+	assert.Nil(t, expr)
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: invalid glob pattern '[abc' at position 25: missing closing ]", err.Error())
+}
+
+func TestParseLists(t *testing.T) {
+	l := createLexer("status not in [500, 502.5, 503,]")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+	expr, err := p.parse()
+
+	assert.Nil(t, err)
+	assert.Equal(t, ek_binary, expr.kind)
+	assert.Equal(t, bo_not_in, expr.binary.operator)
+
+	list := expr.binary.right
+
+	assert.Equal(t, ek_list, list.kind)
+	assert.Equal(t, 3, len(list.list.items))
+	assert.Equal(t, ek_float, list.list.kind)
+	assert.Equal(t, 3, len(list.list.set))
+	assert.Contains(t, list.list.set, set_key_t{kind: ek_integer, integer: 500})
+	assert.Contains(t, list.list.set, set_key_t{kind: ek_float, float: 502.5})
+
+	l = createLexer("method in [:get, :head]")
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+	expr, err = p.parse()
+
+	assert.Nil(t, err)
+	assert.Equal(t, ek_atom, expr.binary.right.list.kind)
+	assert.Nil(t, expr.binary.right.list.set)
+
+	buildAtomSets(expr, map[string]AtomType{":get": 0})
+
+	assert.Nil(t, expr.binary.right.list.set)
+
+	buildAtomSets(expr, map[string]AtomType{":get": 0, ":head": 1})
+
+	assert.Equal(t, map[set_key_t]struct{}{{kind: ek_atom, atom: 0}: {}, {kind: ek_atom, atom: 1}: {}}, expr.binary.right.list.set)
+
+	tests := map[string]string{
+		"a in [1, 'a']": "error: all the list items must have the same type, expected integer but got string",
+		"a in [1 2]":    "error: expected ',' or ']' but got \"2\"",
+		"a in [1, 2":    "error: expected ']' but got end of query",
+		"a in [true]":   "error: lists can only have integers, floats, strings and atoms, but got bool",
+		"a in [[1]]":    "error: lists can only have integers, floats, strings and atoms, but got list",
+		"a in 1":        "error: expected a list, a range or an IP prefix after 'in'",
+		"a not eq 1":    "error: expected 'in' or 'between' after 'not'",
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+		_, err := p.parse()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	l := createLexer("cors between 4 and 10 and running eq true")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+	expr, err := p.parse()
+
+	assert.Nil(t, err)
+	assert.Equal(t, bo_and, expr.binary.operator)
+
+	between := expr.binary.left
+
+	assert.Equal(t, bo_in, between.binary.operator)
+	assert.Equal(t, ek_range, between.binary.right.kind)
+	assert.Equal(t, IntegerType(4), between.binary.right.interval.low.integer)
+	assert.Equal(t, IntegerType(10), between.binary.right.interval.high.integer)
+	assert.Equal(t, false, between.binary.right.interval.exclusive)
+
+	l = createLexer("cors not in 4..<low")
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+	expr, err = p.parse()
+
+	assert.Nil(t, err)
+	assert.Equal(t, bo_not_in, expr.binary.operator)
+	assert.Equal(t, true, expr.binary.right.interval.exclusive)
+	assert.Equal(t, ek_lazy_symbol, expr.binary.right.interval.high.kind)
+
+	tests := map[string]string{
+		"cors between 4 or 10":   "error: expected 'and' after the lower bound of 'between' but got \"or\"",
+		"cors between 4":         "error: expected 'and' after the lower bound of 'between' but got end of query",
+		"cors between [1] and 2": "error: range bounds cannot be lists",
+		"cors in 1..":            "error: missing token",
+	}
+
+	for test, expected := range tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+		_, err := p.parse()
+
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error())
+	}
+}
+
+func TestParseArithmetic(t *testing.T) {
+	l := createLexer("a + b * 2 - c gt 10")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+	expr, err := p.parse()
+
+	assert.Nil(t, err)
+	assert.Equal(t, bo_gt, expr.binary.operator)
+
+	// ((a + (b * 2)) - c)
+	sub := expr.binary.left
+
+	assert.Equal(t, bo_sub, sub.binary.operator)
+	assert.Equal(t, "c", sub.binary.right.symbolName)
+	assert.Equal(t, bo_add, sub.binary.left.binary.operator)
+	assert.Equal(t, "a", sub.binary.left.binary.left.symbolName)
+	assert.Equal(t, bo_mul, sub.binary.left.binary.right.binary.operator)
+	assert.Equal(t, 0, sub.start)
+	assert.Equal(t, 13, sub.end)
+
+	l = createLexer("(a + b) * 2 gt c % 3 and ok")
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+	expr, err = p.parse()
+
+	assert.Nil(t, err)
+	assert.Equal(t, bo_and, expr.binary.operator)
+
+	comparison := expr.binary.left
+
+	assert.Equal(t, bo_gt, comparison.binary.operator)
+	assert.Equal(t, bo_mul, comparison.binary.left.binary.operator)
+	assert.Equal(t, bo_add, comparison.binary.left.binary.left.binary.operator)
+	assert.Equal(t, bo_mod, comparison.binary.right.binary.operator)
+
+	l = createLexer("a gt (b + 1) and duration / (1000 * 60) gt 2")
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+	expr, err = p.parse()
+
+	assert.Nil(t, err)
+
+	right := expr.binary.left.binary.right
+
+	assert.Equal(t, bo_add, right.binary.operator)
+	assert.Equal(t, 5, right.start)
+	assert.Equal(t, 12, right.end)
+
+	divisor := expr.binary.right.binary.left.binary.right
+
+	assert.Equal(t, bo_div, expr.binary.right.binary.left.binary.operator)
+	assert.Equal(t, bo_mul, divisor.binary.operator)
+	assert.Equal(t, 28, divisor.start)
+	assert.Equal(t, 39, divisor.end)
+
+	fail_tests := map[string]string{
+		"a gt (b + 1":      "error: expected ')' but got end of query",
+		"a gt (b gt 1)":    "error: expected ')' but got \"gt\"",
+		"a gt ()":          "error: unexpected token \")\"",
+		"[1, 2] + 1 gt 0":  "error: lists cannot be used in arithmetic expressions",
+		"a + [1] gt 0":     "error: lists cannot be used in arithmetic expressions",
+		"a + gt 0":         "error: unexpected token \"gt\"",
+		"(a gt 1) + 1":     "error: unexpected token \"+\" at position 10",
+		"a * 2 b":          "error: expected comparison operator after expression but got \"b\"",
+		"a in [1, 2] + 3":  "error: lists cannot be used in arithmetic expressions",
+		"size gt 1 + 'x'+": "error: missing token",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+		expr, err := p.parse()
+
+		assert.Nil(t, expr, "test: %s", test)
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+	}
+}
+
+func TestParseNegation(t *testing.T) {
+	l := createLexer("-offset * 2 gt -5")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+	expr, err := p.parse()
+
+	assert.Nil(t, err)
+	assert.Equal(t, bo_gt, expr.binary.operator)
+
+	mul := expr.binary.left
+
+	assert.Equal(t, bo_mul, mul.binary.operator)
+	assert.Equal(t, ek_unary, mul.binary.left.kind)
+	assert.Equal(t, uo_neg, mul.binary.left.unary.operator)
+	assert.Equal(t, "offset", mul.binary.left.unary.operand.symbolName)
+	assert.Equal(t, 0, mul.binary.left.start)
+	assert.Equal(t, 7, mul.binary.left.end)
+
+	assert.Equal(t, ek_integer, expr.binary.right.kind)
+	assert.Equal(t, IntegerType(-5), expr.binary.right.integer)
+
+	l = createLexer("-[1] gt 0")
+
+	assert.Nil(t, l.lex())
+
+	p = createParser(l.tokens)
+	expr, err = p.parse()
+
+	assert.Nil(t, expr)
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: lists cannot be used in arithmetic expressions", err.Error())
+}
+
+func TestParseCalls(t *testing.T) {
+	l := createLexer("coalesce(region, lower('US'), 1 + 2) eq 'us'")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+	expr, err := p.parse()
+
+	assert.Nil(t, err)
+
+	call := expr.binary.left
+
+	assert.Equal(t, ek_call, call.kind)
+	assert.Equal(t, "coalesce", call.symbolName)
+	assert.Equal(t, functions["coalesce"], call.call.function)
+	assert.Equal(t, 3, len(call.call.args))
+	assert.Equal(t, ek_lazy_symbol, call.call.args[0].kind)
+	assert.Equal(t, ek_call, call.call.args[1].kind)
+	assert.Equal(t, bo_add, call.call.args[2].binary.operator)
+	assert.Equal(t, 0, call.start)
+	assert.Equal(t, 36, call.end)
+
+	fail_tests := map[string]string{
+		"foo(name) eq 1":        "error: the function 'foo' does not exist at position 1",
+		"len() eq 1":            "error: the function 'len' takes 1 argument but got 0 at position 1",
+		"abs(a, b) eq 1":        "error: the function 'abs' takes 1 argument but got 2 at position 1",
+		"coalesce() eq 1":       "error: the function 'coalesce' takes at least 1 argument but got 0 at position 1",
+		"len(10) gt 3":          "error: you cannot call len(integer) at position 1",
+		"abs('x') gt 3":         "error: you cannot call abs(string) at position 1",
+		"lower(len('x')) eq 1":  "error: you cannot call lower(integer) at position 1",
+		"coalesce(1, 'a') eq 1": "error: you cannot call coalesce(integer, string) at position 1",
+		"len(name":              "error: expected ')' but got end of query",
+		"len(name name) gt 1":   "error: expected ',' or ')' but got \"name\"",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+		expr, err := p.parse()
+
+		assert.Nil(t, expr, "test: %s", test)
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+	}
+}
+
+func TestParseQuantifiers(t *testing.T) {
+	l := createLexer("any(tags, _ reg '^team-' or _ eq 'ops')")
+
+	assert.Nil(t, l.lex())
+
+	p := createParser(l.tokens)
+	expr, err := p.parse()
+
+	assert.Nil(t, err)
+	assert.Equal(t, ek_call, expr.kind)
+	assert.Equal(t, functions["any"], expr.call.function)
+	assert.Equal(t, 2, len(expr.call.args))
+	assert.Equal(t, ek_lazy_symbol, expr.call.args[0].kind)
+	assert.Equal(t, bo_or, expr.call.args[1].binary.operator)
+	assert.NotNil(t, expr.call.args[1].binary.left.binary.right.regex)
+
+	fail_tests := map[string]string{
+		"any(tags)":                   "error: the function 'any' takes 2 arguments but got 1 at position 1",
+		"all(tags, _ eq 'a', _ eq 1)": "error: the function 'all' takes 2 arguments but got 3 at position 1",
+		"any(tags, _ eq)":             "error: unexpected token \")\"",
+	}
+
+	for test, expected := range fail_tests {
+		l := createLexer(test)
+
+		assert.Nil(t, l.lex())
+
+		p := createParser(l.tokens)
+		expr, err := p.parse()
+
+		assert.Nil(t, expr, "test: %s", test)
+		assert.NotNil(t, err, "test: %s", test)
+		assert.Equal(t, expected, err.Error(), "test: %s", test)
+	}
+}
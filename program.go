@@ -0,0 +1,233 @@
+package quang
+
+import (
+	"net/netip"
+	"time"
+)
+
+// A compiled query together with its atoms.
+// It never changes after being compiled, so the same program can be
+// evaluated concurrently from many goroutines, each one with its own `Env`.
+type Program struct {
+	expression *expression_t
+	query      string
+	atoms      map[string]AtomType
+
+	// tells the current time to `now()`, `time.Now` when not set
+	clock func() time.Time
+}
+
+// The variables of a single evaluation.
+// An env must not be modified while a program is evaluating it, but
+// it can be reused (and overwritten) between evaluations.
+type Env struct {
+	symbols symbol_table_t
+
+	// tells the current time to `now()`, `time.Now` when not set
+	clock func() time.Time
+}
+
+// Compile the query and the set of available atoms into a program.
+// The atoms are copied, changing the map afterwards does not affect the program.
+func Compile(query string, atoms map[string]AtomType) (*Program, error) {
+	expr, err := parseQuery(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	program := &Program{
+		expression: expr,
+		query:      query,
+		atoms:      make(map[string]AtomType, len(atoms)),
+	}
+
+	for name, value := range atoms {
+		atom, err := parseAtomName(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		program.atoms[atom] = value
+	}
+
+	// the atoms of a program never change, so its lists of atoms can be sets
+	buildAtomSets(program.expression, program.atoms)
+
+	return program, nil
+}
+
+// Copy of the program using `clock` for `now()` in all of its evaluations.
+// The program itself is not changed, so it is still safe to share.
+// The clock of an `Env` takes precedence over it in `Eval`
+func (p *Program) WithClock(clock func() time.Time) *Program {
+	program := *p
+
+	program.clock = clock
+
+	return &program
+}
+
+// Snapshot of the current query, atoms and clock as a program.
+// Atoms set up after calling it do not affect the program.
+func (q *Quang) Program() *Program {
+	program := &Program{
+		expression: q.evaluator.expression,
+		query:      q.evaluator.query,
+		atoms:      make(map[string]AtomType, len(q.evaluator.atoms)),
+		clock:      q.evaluator.clock,
+	}
+
+	for name, value := range q.evaluator.atoms {
+		program.atoms[name] = value
+	}
+
+	return program
+}
+
+// A fresh evaluator for a single evaluation of the program, the program itself is only read
+func (p *Program) evaluator() evaluator_t {
+	return evaluator_t{
+		atoms:      p.atoms,
+		expression: p.expression,
+		query:      p.query,
+		clock:      p.clock,
+	}
+}
+
+// Evaluates the program against the variables of `env`.
+// A nil env is the same as an empty one.
+func (p *Program) Eval(env *Env) (bool, error) {
+	e := p.evaluator()
+
+	if env != nil {
+		e.symbols = env.symbols
+
+		if env.clock != nil {
+			e.clock = env.clock
+		}
+	}
+
+	return e.eval()
+}
+
+// Evaluates the program reading the variables straight from `record`.
+// See `Quang.EvalMap` for the supported values.
+func (p *Program) EvalMap(record map[string]any) (bool, error) {
+	e := p.evaluator()
+
+	return e.evalMap(record)
+}
+
+// Evaluates the program asking `resolver` for each variable the query needs.
+func (p *Program) EvalResolver(resolver Resolver) (bool, error) {
+	e := p.evaluator()
+
+	return e.evalResolver(resolver)
+}
+
+func NewEnv() *Env {
+	return &Env{
+		symbols: make(symbol_table_t),
+	}
+}
+
+// Removes all the variables, so the env can be reused for the next evaluation
+func (env *Env) Reset() *Env {
+	clear(env.symbols)
+
+	return env
+}
+
+func (env *Env) AddStringVar(name, value string) *Env {
+	env.symbols.addStringVar(name, value)
+
+	return env
+}
+
+func (env *Env) AddIntegerVar(name string, value IntegerType) *Env {
+	env.symbols.addIntegerVar(name, value)
+
+	return env
+}
+
+func (env *Env) AddFloatVar(name string, value FloatType) *Env {
+	env.symbols.addFloatVar(name, value)
+
+	return env
+}
+
+func (env *Env) AddBoolVar(name string, value bool) *Env {
+	env.symbols.addBoolVar(name, value)
+
+	return env
+}
+
+func (env *Env) AddAtomVar(name string, value AtomType) *Env {
+	env.symbols.addAtomVar(name, value)
+
+	return env
+}
+
+func (env *Env) AddNilVar(name string) *Env {
+	env.symbols.addNilVar(name)
+
+	return env
+}
+
+func (env *Env) AddTimeVar(name string, value time.Time) *Env {
+	env.symbols.addTimeVar(name, value)
+
+	return env
+}
+
+func (env *Env) AddDurationVar(name string, value time.Duration) *Env {
+	env.symbols.addDurationVar(name, value)
+
+	return env
+}
+
+func (env *Env) AddIPVar(name string, value netip.Addr) *Env {
+	env.symbols.addIPVar(name, value)
+
+	return env
+}
+
+// Replaces the clock used by `now()`, see `Quang.SetClock`.
+// The clock is kept by `Reset`
+func (env *Env) SetClock(clock func() time.Time) *Env {
+	env.clock = clock
+
+	return env
+}
+
+func (env *Env) AddStringListVar(name string, values []string) *Env {
+	env.symbols.addStringListVar(name, values)
+
+	return env
+}
+
+func (env *Env) AddIntegerListVar(name string, values []IntegerType) *Env {
+	env.symbols.addIntegerListVar(name, values)
+
+	return env
+}
+
+func (env *Env) AddFloatListVar(name string, values []FloatType) *Env {
+	env.symbols.addFloatListVar(name, values)
+
+	return env
+}
+
+func (env *Env) AddAtomListVar(name string, values []AtomType) *Env {
+	env.symbols.addAtomListVar(name, values)
+
+	return env
+}
+
+// Provides the variables from the exported fields of a struct.
+// See `Quang.EvalStruct` for how fields are mapped.
+func (env *Env) BindStruct(v any) error {
+	return env.symbols.bindStruct(v)
+}
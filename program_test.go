@@ -0,0 +1,246 @@
+package quang_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcos-venicius/quang"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgram(t *testing.T) {
+	program, err := quang.Compile("size gt 0 and method eq :get", map[string]quang.AtomType{
+		":get":  0,
+		":post": 1,
+	})
+
+	assert.Nil(t, err)
+
+	env := quang.NewEnv()
+
+	r, err := program.Eval(env.AddIntegerVar("size", 1).AddAtomVar("method", 0))
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+
+	r, err = program.Eval(env.AddAtomVar("method", 1))
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+
+	r, err = program.Eval(env.Reset())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, false, r)
+	assert.Equal(t, "error: the variable 'size' does not exist", err.Error())
+
+	r, err = program.Eval(nil)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, false, r)
+
+	r, err = program.EvalMap(map[string]any{"size": 10, "method": quang.AtomType(0)})
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+
+	_, err = quang.Compile("size gt 0", map[string]quang.AtomType{"get": 0})
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: invalid atom name", err.Error())
+}
+
+func TestProgramLists(t *testing.T) {
+	program, err := quang.Compile("any(tags, _ reg '^team-') and not roles contains :admin", map[string]quang.AtomType{
+		":admin": 0,
+	})
+
+	assert.Nil(t, err)
+
+	env := quang.NewEnv().AddStringListVar("tags", []string{"prod", "team-api"}).AddAtomListVar("roles", []quang.AtomType{1})
+
+	r, err := program.Eval(env)
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+
+	r, err = program.Eval(env.AddAtomListVar("roles", []quang.AtomType{1, 0}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+
+	r, err = program.Eval(env.AddStringListVar("tags", nil))
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+}
+
+func TestProgramAtomLists(t *testing.T) {
+	atoms := map[string]quang.AtomType{":get": 0, ":head": 1, ":post": 2}
+
+	tests := map[string]bool{
+		"method in [:get, :head]":       true,
+		"method in [:head, :get]":       true,
+		"method not in [:post, :head]":  true,
+		"[:post, :get] contains method": true,
+	}
+
+	for query, expected := range tests {
+		program, err := quang.Compile(query, atoms)
+
+		assert.Nil(t, err)
+
+		r, err := program.Eval(quang.NewEnv().AddAtomVar("method", 0))
+
+		assert.Nil(t, err, "query: %s", query)
+		assert.Equal(t, expected, r, "query: %s", query)
+	}
+
+	for _, query := range []string{"method in [:get, :nope]", "method in [:nope, :get]"} {
+		program, err := quang.Compile(query, atoms)
+
+		assert.Nil(t, err)
+
+		r, err := program.Eval(quang.NewEnv().AddAtomVar("method", 0))
+
+		assert.NotNil(t, err, "query: %s", query)
+		assert.Equal(t, "error: the atom ':nope' does not exist", err.Error())
+		assert.Equal(t, false, r)
+	}
+}
+
+func TestProgramClock(t *testing.T) {
+	program, err := quang.Compile("ts gt now() - 1h", nil)
+
+	assert.Nil(t, err)
+
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	env := quang.NewEnv().AddTimeVar("ts", ts).SetClock(func() time.Time {
+		return ts.Add(30 * time.Minute)
+	})
+
+	r, err := program.Eval(env)
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+
+	r, err = program.Eval(env.Reset().AddTimeVar("ts", ts.Add(-2*time.Hour)))
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+
+	q, err := quang.Init("elapsed lt 1s and ts lt now()")
+
+	assert.Nil(t, err)
+
+	r, err = q.AddDurationVar("elapsed", 250*time.Millisecond).AddTimeVar("ts", ts).SetClock(func() time.Time { return ts }).Eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+}
+
+func TestProgramWithClock(t *testing.T) {
+	program, err := quang.Compile("ts gt now() - 1h", nil)
+
+	assert.Nil(t, err)
+
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	clocked := program.WithClock(func() time.Time {
+		return ts.Add(30 * time.Minute)
+	})
+
+	r, err := clocked.EvalMap(map[string]any{"ts": ts})
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+
+	r, err = clocked.EvalResolver(quang.ResolverFunc(func(name string) (quang.Value, bool, error) {
+		return quang.TimeValue(ts), true, nil
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+
+	r, err = clocked.Eval(quang.NewEnv().AddTimeVar("ts", ts))
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+
+	// the clock of the env wins over the one of the program
+	r, err = clocked.Eval(quang.NewEnv().AddTimeVar("ts", ts).SetClock(func() time.Time {
+		return ts.Add(2 * time.Hour)
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+
+	// the original program still uses `time.Now`
+	r, err = program.EvalMap(map[string]any{"ts": ts})
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+
+	q, err := quang.Init("ts gt now() - 1h")
+
+	assert.Nil(t, err)
+
+	r, err = q.SetClock(func() time.Time { return ts }).Program().EvalMap(map[string]any{"ts": ts})
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+}
+
+func TestProgramFromQuang(t *testing.T) {
+	q, err := quang.Init("method eq :get")
+
+	assert.Nil(t, err)
+
+	q.SetupAtom(":get", 0)
+
+	program := q.Program()
+
+	q.SetupAtom(":get", 1)
+
+	r, err := program.Eval(quang.NewEnv().AddAtomVar("method", 0))
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+}
+
+func TestProgramConcurrentEvaluation(t *testing.T) {
+	program, err := quang.Compile("(status gte 500 or agent reg '^bot') and method eq :get", map[string]quang.AtomType{
+		":get": 0,
+	})
+
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+
+			env := quang.NewEnv()
+
+			for i := 0; i < 200; i++ {
+				status := quang.IntegerType(200 + (i+worker)%2*300)
+
+				env.AddIntegerVar("status", status).
+					AddStringVar("agent", "curl").
+					AddAtomVar("method", 0)
+
+				r, err := program.Eval(env)
+
+				assert.Nil(t, err)
+				assert.Equal(t, status >= 500, r)
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+}
@@ -1,27 +1,43 @@
 package quang
 
+import (
+	"net/netip"
+	"time"
+)
+
 type Quang struct {
 	evaluator evaluator_t
 }
 
-// Init the whole language. `query` is the expression provided by
-// the user, for example: `size gt 0` which will be evaluated later.
-func Init(query string) (*Quang, error) {
+func parseQuery(query string) (*expression_t, error) {
 	l := createLexer(query)
 
 	if err := l.lex(); err != nil {
-		return nil, err
+		return nil, locateError(query, err)
 	}
 
 	p := createParser(l.tokens)
 
-	expr, err := p.parseExpression()
+	expr, err := p.parse()
+
+	if err != nil {
+		return nil, locateError(query, err)
+	}
+
+	return expr, nil
+}
+
+// Init the whole language. `query` is the expression provided by
+// the user, for example: `size gt 0` which will be evaluated later.
+func Init(query string) (*Quang, error) {
+	expr, err := parseQuery(query)
 
 	if err != nil {
 		return nil, err
 	}
 
 	evaluator := createEvaluator(expr)
+	evaluator.query = query
 
 	return &Quang{
 		evaluator: evaluator,
@@ -112,6 +128,123 @@ func (q *Quang) AddAtomVar(name string, value AtomType) *Quang {
 	return q
 }
 
+// For each evaluation, you can provide different variable values.
+// Declares the variable as explicitly nil, which means `name eq nil` will be true.
+// Variables that were never declared are also considered nil when compared against `nil`,
+// but they fail in any other kind of comparison
+func (q *Quang) AddNilVar(name string) *Quang {
+	q.evaluator.addNilVar(name)
+
+	return q
+}
+
+// For each evaluation, you can provide different variable values.
+// Times are compared with time literals, like `ts gt 2024-05-01T00:00:00Z`,
+// and can be moved by durations, like `ts gt now() - 1h`
+func (q *Quang) AddTimeVar(name string, value time.Time) *Quang {
+	q.evaluator.addTimeVar(name, value)
+
+	return q
+}
+
+// For each evaluation, you can provide different variable values.
+// Durations are compared with duration literals, like `elapsed gte 250ms`
+func (q *Quang) AddDurationVar(name string, value time.Duration) *Quang {
+	q.evaluator.addDurationVar(name, value)
+
+	return q
+}
+
+// For each evaluation, you can provide different variable values.
+// Addresses are compared with IP literals, like `dst_ip eq 192.168.1.1`,
+// and matched against networks with `src_ip in 10.0.0.0/8`
+func (q *Quang) AddIPVar(name string, value netip.Addr) *Quang {
+	q.evaluator.addIPVar(name, value)
+
+	return q
+}
+
+// Replaces the clock used by `now()`, which is `time.Now` by default.
+// Useful to make queries with `now()` deterministic in tests
+func (q *Quang) SetClock(clock func() time.Time) *Quang {
+	q.evaluator.clock = clock
+
+	return q
+}
+
+// For each evaluation, you can provide different variable values.
+// Declares a list of strings, which can be queried with `tags contains 'prod'`,
+// `any`, `all` and `len`
+func (q *Quang) AddStringListVar(name string, values []string) *Quang {
+	q.evaluator.addStringListVar(name, values)
+
+	return q
+}
+
+// For each evaluation, you can provide different variable values.
+// Declares a list of integers, which can be queried with `ports contains 443`,
+// `any`, `all` and `len`
+func (q *Quang) AddIntegerListVar(name string, values []IntegerType) *Quang {
+	q.evaluator.addIntegerListVar(name, values)
+
+	return q
+}
+
+// For each evaluation, you can provide different variable values.
+// Declares a list of floats, which can be queried with `latencies contains 0.5`,
+// `any(latencies, _ gt 1.5)`, `all` and `len`
+func (q *Quang) AddFloatListVar(name string, values []FloatType) *Quang {
+	q.evaluator.addFloatListVar(name, values)
+
+	return q
+}
+
+// For each evaluation, you can provide different variable values.
+// Declares a list of atoms, which can be queried with `roles contains :admin`,
+// `any`, `all` and `len`
+func (q *Quang) AddAtomListVar(name string, values []AtomType) *Quang {
+	q.evaluator.addAtomListVar(name, values)
+
+	return q
+}
+
+// Provides the variables from the exported fields of a struct (or a pointer to a struct)
+// and evaluates the query against them.
+// The variable name is the field name, unless the field has a tag like `quang:"status"`,
+// fields tagged with `quang:"-"` are ignored.
+// Integer kinds (int*, uint*) become integers, float kinds become floats, and string and bool kinds
+// are used as is. `AtomType` fields become atoms, `time.Time` fields times, `time.Duration` fields
+// durations and `netip.Addr` fields IPs. Slices of those become lists, nested structs are bound
+// with dotted names and the fields of embedded structs are promoted.
+// Nil pointer fields become nil, other field types are ignored.
+// The fields of each struct type are only inspected once, so it's cheap to call it for every row.
+func (q *Quang) EvalStruct(v any) (bool, error) {
+	if err := q.evaluator.symbols.bindStruct(v); err != nil {
+		return false, err
+	}
+
+	return q.evaluator.eval()
+}
+
+// Evaluates the query reading the variables straight from `record`, which is useful
+// for decoded JSON. Supported values are strings, bools, nil, float64, json.Number,
+// Go integers, `time.Time`, `time.Duration`, `netip.Addr`, the quang types (`IntegerType`,
+// `FloatType`, `AtomType`), nested maps and slices.
+// Variables provided with `AddStringVar`, `AddIntegerVar`, etc, are not used by this evaluation.
+func (q *Quang) EvalMap(record map[string]any) (bool, error) {
+	return q.evaluator.evalMap(record)
+}
+
+// Evaluates the query asking `resolver` for each variable, only when the query needs it.
+// Variables provided with `AddStringVar`, `AddIntegerVar`, etc, are not used by this evaluation.
+func (q *Quang) EvalResolver(resolver Resolver) (bool, error) {
+	return q.evaluator.evalResolver(resolver)
+}
+
+// Evaluates the query against the current variables.
+// `and` and `or` are short-circuited: the right side of `a and b` is skipped when `a` is false
+// and the right side of `a or b` is skipped when `a` is true. Errors that would only happen
+// on a skipped side (missing variables or atoms, type mismatches, invalid regex, ...) are not reported.
 func (q Quang) Eval() (bool, error) {
 	return q.evaluator.eval()
 }
@@ -1,6 +1,8 @@
 package quang_test
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/marcos-venicius/quang"
@@ -63,3 +65,87 @@ func TestApi(t *testing.T) {
 		assert.Equal(t, test.result, r)
 	}
 }
+
+func TestApiNil(t *testing.T) {
+	q, err := quang.Init("name eq nil or size eq 0")
+
+	assert.Nil(t, err)
+
+	r, err := q.AddIntegerVar("size", 1).Eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+
+	r, err = q.AddStringVar("name", "john").Eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+
+	r, err = q.AddNilVar("name").Eval()
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+}
+
+func TestApiInvalidRegex(t *testing.T) {
+	q, err := quang.Init("agent reg '[a-'")
+
+	assert.Nil(t, q)
+	assert.NotNil(t, err)
+	assert.Equal(t, "error: invalid regex pattern '[a-' at position 11: error parsing regexp: missing closing ]: `[a-`", err.Error())
+}
+
+func TestApiEvalStruct(t *testing.T) {
+	type row_t struct {
+		Size   int            `quang:"size"`
+		Status int            `quang:"status"`
+		Method quang.AtomType `quang:"method"`
+		Agent  *string        `quang:"agent"`
+	}
+
+	q, err := quang.Init("size gt 0 and method eq :get and status eq 200 and agent eq nil")
+
+	assert.Nil(t, err)
+
+	q.SetupAtom(":get", 0)
+
+	r, err := q.EvalStruct(row_t{Size: 1, Status: 200, Method: 0})
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+
+	agent := "curl"
+
+	r, err = q.EvalStruct(&row_t{Size: 1, Status: 200, Method: 0, Agent: &agent})
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+
+	r, err = q.EvalStruct(row_t{Size: 1, Status: 200, Method: 1})
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+}
+
+func TestApiEvalMap(t *testing.T) {
+	q, err := quang.Init("status gte 500 or path reg '^/admin'")
+
+	assert.Nil(t, err)
+
+	var record map[string]any
+
+	decoder := json.NewDecoder(strings.NewReader(`{"status": 200, "path": "/admin/users"}`))
+	decoder.UseNumber()
+
+	assert.Nil(t, decoder.Decode(&record))
+
+	r, err := q.EvalMap(record)
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+
+	r, err = q.EvalMap(map[string]any{"status": 200, "path": "/"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+}
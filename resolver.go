@@ -0,0 +1,136 @@
+package quang
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Provides variable values on demand.
+// `Resolve` is only called when the query actually needs the variable, so
+// with short-circuiting, expensive fields are not computed when they do not matter.
+// It returns false when the variable does not exist, which works just like
+// a variable that was never provided.
+type Resolver interface {
+	Resolve(name string) (Value, bool, error)
+}
+
+// Adapter to use ordinary functions as resolvers
+type ResolverFunc func(name string) (Value, bool, error)
+
+func (f ResolverFunc) Resolve(name string) (Value, bool, error) {
+	return f(name)
+}
+
+// A value provided by a resolver. Use the constructors bellow to create one.
+type Value struct {
+	variable variable_t
+}
+
+func StringValue(value string) Value {
+	return Value{variable: variable_t{dtype: dtype_string, string: value}}
+}
+
+func IntegerValue(value IntegerType) Value {
+	return Value{variable: variable_t{dtype: dtype_integer, integer: value}}
+}
+
+func FloatValue(value FloatType) Value {
+	return Value{variable: variable_t{dtype: dtype_float, float: value}}
+}
+
+func BoolValue(value bool) Value {
+	return Value{variable: variable_t{dtype: dtype_bool, bool: value}}
+}
+
+func AtomValue(value AtomType) Value {
+	return Value{variable: variable_t{dtype: dtype_atom, atom: value}}
+}
+
+func NilValue() Value {
+	return Value{variable: variable_t{dtype: dtype_nil}}
+}
+
+func TimeValue(value time.Time) Value {
+	return Value{variable: variable_t{dtype: dtype_time, time: value}}
+}
+
+func DurationValue(value time.Duration) Value {
+	return Value{variable: variable_t{dtype: dtype_duration, duration: value}}
+}
+
+func IPValue(value netip.Addr) Value {
+	return Value{variable: variable_t{dtype: dtype_ip, ip: value.Unmap()}}
+}
+
+func StringListValue(values []string) Value {
+	return Value{variable: stringListVariable(values)}
+}
+
+func IntegerListValue(values []IntegerType) Value {
+	return Value{variable: integerListVariable(values)}
+}
+
+func FloatListValue(values []FloatType) Value {
+	return Value{variable: floatListVariable(values)}
+}
+
+func AtomListValue(values []AtomType) Value {
+	return Value{variable: atomListVariable(values)}
+}
+
+type map_resolver_t map[string]any
+
+func (m map_resolver_t) Resolve(name string) (Value, bool, error) {
+	value, ok := m[name]
+
+	if !ok {
+		root, path, dotted := strings.Cut(name, ".")
+
+		if !dotted {
+			return Value{}, false, nil
+		}
+
+		if value, ok = m[root]; !ok {
+			return Value{}, false, nil
+		}
+
+		nested, err := resolvePath(root, value, path)
+
+		if err != nil {
+			return Value{}, false, err
+		}
+
+		value = nested
+	}
+
+	variable, err := valueToVariable(name, value)
+
+	return Value{variable: variable}, true, err
+}
+
+// Walks nested maps following a dotted `path`, a missing key anywhere in the path results in nil.
+// `name` is the part of the path already walked, used to report errors
+func resolvePath(name string, value any, path string) (any, error) {
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case nil:
+			return nil, nil
+		case map[string]any:
+			child, ok := v[key]
+
+			if !ok {
+				return nil, nil
+			}
+
+			value = child
+		default:
+			return nil, fmt.Errorf("error: the variable '%s' has type %T, so it has no field '%s'", name, value, key)
+		}
+
+		name += "." + key
+	}
+
+	return value, nil
+}
@@ -0,0 +1,184 @@
+package quang_test
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/marcos-venicius/quang"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolver(t *testing.T) {
+	q, err := quang.Init("status gte 500 or (country eq 'br' and agent reg '^curl')")
+
+	assert.Nil(t, err)
+
+	calls := map[string]int{}
+
+	values := map[string]quang.Value{
+		"status":  quang.IntegerValue(503),
+		"country": quang.StringValue("us"),
+		"agent":   quang.StringValue("curl/8"),
+	}
+
+	resolver := quang.ResolverFunc(func(name string) (quang.Value, bool, error) {
+		calls[name]++
+
+		value, ok := values[name]
+
+		return value, ok, nil
+	})
+
+	r, err := q.EvalResolver(resolver)
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+	assert.Equal(t, map[string]int{"status": 1}, calls)
+
+	values["status"] = quang.IntegerValue(200)
+
+	r, err = q.EvalResolver(resolver)
+
+	assert.Nil(t, err)
+	assert.Equal(t, false, r)
+	assert.Equal(t, map[string]int{"status": 2, "country": 1}, calls)
+
+	values["country"] = quang.StringValue("br")
+
+	r, err = q.EvalResolver(resolver)
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+	assert.Equal(t, map[string]int{"status": 3, "country": 2, "agent": 1}, calls)
+}
+
+func TestResolverValues(t *testing.T) {
+	program, err := quang.Compile("a eq 'x' and b eq 1 and c eq 1.5 and d and e eq :e and f eq nil and g eq nil and h contains 'x' and i contains 2 and j contains 2.5 and k contains :e and l in 10.0.0.0/8", map[string]quang.AtomType{
+		":e": 3,
+	})
+
+	assert.Nil(t, err)
+
+	values := map[string]quang.Value{
+		"a": quang.StringValue("x"),
+		"b": quang.IntegerValue(1),
+		"c": quang.FloatValue(1.5),
+		"d": quang.BoolValue(true),
+		"e": quang.AtomValue(3),
+		"f": quang.NilValue(),
+		"h": quang.StringListValue([]string{"x", "y"}),
+		"i": quang.IntegerListValue([]quang.IntegerType{1, 2}),
+		"j": quang.FloatListValue([]quang.FloatType{2.5}),
+		"k": quang.AtomListValue([]quang.AtomType{3}),
+		"l": quang.IPValue(netip.MustParseAddr("10.0.0.1")),
+	}
+
+	r, err := program.EvalResolver(quang.ResolverFunc(func(name string) (quang.Value, bool, error) {
+		value, ok := values[name]
+
+		return value, ok, nil
+	}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, true, r)
+}
+
+func TestResolverErrors(t *testing.T) {
+	q, err := quang.Init("country eq 'br'")
+
+	assert.Nil(t, err)
+
+	lookupErr := errors.New("geoip: database unavailable")
+
+	r, err := q.EvalResolver(quang.ResolverFunc(func(name string) (quang.Value, bool, error) {
+		return quang.Value{}, false, lookupErr
+	}))
+
+	assert.Equal(t, false, r)
+	assert.ErrorIs(t, err, lookupErr)
+}
+
+func TestResolverNilableVariables(t *testing.T) {
+	tests := map[string]bool{
+		"body ne nil":                   true,
+		"coalesce(body, 'a') eq 'x'":    true,
+		"missing eq nil":                true,
+		"coalesce(missing, 'a') eq 'a'": true,
+	}
+
+	for query, expected := range tests {
+		q, err := quang.Init(query)
+
+		assert.Nil(t, err)
+
+		calls := map[string]int{}
+
+		r, err := q.EvalResolver(quang.ResolverFunc(func(name string) (quang.Value, bool, error) {
+			calls[name]++
+
+			if name == "body" {
+				return quang.StringValue("x"), true, nil
+			}
+
+			return quang.Value{}, false, nil
+		}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, r, "query: %s", query)
+
+		for name, count := range calls {
+			assert.Equal(t, 1, count, "query: %s, variable: %s", query, name)
+		}
+
+		assert.Equal(t, 1, len(calls), "query: %s", query)
+	}
+}
+
+func TestResolverResolvesEachVariableOnce(t *testing.T) {
+	tests := map[string]bool{
+		"geo gt 1 and geo lt 5":            true,
+		"any(tags, _ eq geo)":              false,
+		"all(tags, _ ne geo) and geo eq 3": true,
+		"missing eq nil and coalesce(missing, geo) eq 3 and missing eq nil": true,
+	}
+
+	for query, expected := range tests {
+		q, err := quang.Init(query)
+
+		assert.Nil(t, err)
+
+		calls := map[string]int{}
+
+		resolver := quang.ResolverFunc(func(name string) (quang.Value, bool, error) {
+			calls[name]++
+
+			switch name {
+			case "geo":
+				return quang.IntegerValue(3), true, nil
+			case "tags":
+				return quang.IntegerListValue([]quang.IntegerType{1, 2, 4}), true, nil
+			}
+
+			return quang.Value{}, false, nil
+		})
+
+		r, err := q.EvalResolver(resolver)
+
+		assert.Nil(t, err, "query: %s", query)
+		assert.Equal(t, expected, r, "query: %s", query)
+
+		for name, count := range calls {
+			assert.Equal(t, 1, count, "query: %s, variable: %s", query, name)
+		}
+
+		// values are cached only during a single evaluation
+		_, err = q.EvalResolver(resolver)
+
+		assert.Nil(t, err, "query: %s", query)
+
+		for name, count := range calls {
+			assert.Equal(t, 2, count, "query: %s, variable: %s", query, name)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package quang
+
+import (
+	"math"
+	"time"
+)
+
+func isTemporalKind(kind expression_kind_t) bool {
+	return kind == ek_time || kind == ek_duration
+}
+
+// Kind of the result of an arithmetic operation with times or durations.
+// Times can be moved by durations, `now() - 1h`, and subtracted from each other, resulting in a duration.
+// Durations can be added to each other, scaled by numbers, `timeout * 2`, and divided by each other, resulting in a float
+func temporalKind(left expression_kind_t, op binary_operator_t, right expression_kind_t) (expression_kind_t, bool) {
+	switch {
+	case left == ek_time && right == ek_time:
+		return ek_duration, op == bo_sub
+	case left == ek_time && right == ek_duration:
+		return ek_time, op == bo_add || op == bo_sub
+	case left == ek_duration && right == ek_time:
+		return ek_time, op == bo_add
+	case left == ek_duration && right == ek_duration:
+		if op == bo_div {
+			return ek_float, true
+		}
+
+		return ek_duration, op == bo_add || op == bo_sub
+	case left == ek_duration && isNumberKind(right):
+		return ek_duration, op == bo_mul || op == bo_div
+	case isNumberKind(left) && right == ek_duration:
+		return ek_duration, op == bo_mul
+	}
+
+	return ek_nil, false
+}
+
+// The operation must be valid according to `temporalKind`
+func calcTemporal(expr *expression_t, left *expression_t, op binary_operator_t, right *expression_t) (*expression_t, error) {
+	kind, _ := temporalKind(left.kind, op, right.kind)
+
+	result := &expression_t{
+		kind:  kind,
+		start: expr.start,
+		end:   expr.end,
+	}
+
+	switch {
+	case left.kind == ek_time && right.kind == ek_time:
+		result.duration = left.time.Sub(right.time)
+	case left.kind == ek_time:
+		if op == bo_sub {
+			result.time = left.time.Add(-right.duration)
+		} else {
+			result.time = left.time.Add(right.duration)
+		}
+	case right.kind == ek_time:
+		result.time = right.time.Add(left.duration)
+	case left.kind == ek_duration && right.kind == ek_duration:
+		switch op {
+		case bo_add:
+			result.duration = left.duration + right.duration
+		case bo_sub:
+			result.duration = left.duration - right.duration
+		case bo_div:
+			if right.duration == 0 {
+				return nil, arithmeticError(expr, "error: division by zero")
+			}
+
+			result.float = FloatType(left.duration) / FloatType(right.duration)
+		}
+	case left.kind == ek_duration:
+		if op == bo_div && toFloat(right) == 0 {
+			return nil, arithmeticError(expr, "error: division by zero")
+		}
+
+		return scaleDuration(expr, result, left.duration, op, toFloat(right))
+	default:
+		return scaleDuration(expr, result, right.duration, op, toFloat(left))
+	}
+
+	return result, nil
+}
+
+// Durations are multiplied or divided by numbers as floats, so `1s * 1.5` is `1.5s`
+func scaleDuration(expr *expression_t, result *expression_t, duration time.Duration, op binary_operator_t, factor FloatType) (*expression_t, error) {
+	scaled := float64(duration) * float64(factor)
+
+	if op == bo_div {
+		scaled = float64(duration) / float64(factor)
+	}
+
+	if math.IsNaN(scaled) || scaled >= math.MaxInt64 || scaled < math.MinInt64 {
+		return nil, arithmeticError(expr, "error: the duration %s %s %g overflows", duration, bo_to_string[op], factor)
+	}
+
+	result.duration = time.Duration(scaled)
+
+	return result, nil
+}
+
+func cmpTimeToTime(left time.Time, op binary_operator_t, right time.Time) (bool, error) {
+	return cmpIntegerToInteger(IntegerType(left.Compare(right)), op, 0)
+}
+
+func cmpDurationToDuration(left time.Duration, op binary_operator_t, right time.Duration) (bool, error) {
+	return cmpIntegerToInteger(IntegerType(left), op, IntegerType(right))
+}
@@ -7,3 +7,12 @@ func isDigit[T byte | rune](c T) bool {
 func isSymbol[T byte | rune](c T) bool {
 	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
 }
+
+// Digits are allowed in names, but not as their first character
+func isSymbolPart[T byte | rune](c T) bool {
+	return isSymbol(c) || isDigit(c)
+}
+
+func isWhitespace[T byte | rune](c T) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}